@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GarbageCollect deletes orphaned objects from the bucket right away. With
+// ?dry_run=true it only reports what would be deleted
+func GarbageCollect(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	dryRun := false
+	if v := c.Query("dry_run"); v != "" {
+		var err error
+
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "dry_run must be true or false",
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
+	report, err := service.CollectGarbage(d.DB, d.Uploader, service.GCGrace(), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to collect orphaned objects", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type planOpts struct {
+	Name              *string   `json:"name"`
+	MaxStorage        *int64    `json:"max_storage"`
+	MaxUploadSize     *int64    `json:"max_upload_size"`
+	MaxConcurrentJobs *int      `json:"max_concurrent_jobs"`
+	MaxDuration       *float64  `json:"max_duration"`
+	OutputFormats     *[]string `json:"output_formats"`
+	HLS               *bool     `json:"hls"`
+	Default           *bool     `json:"default"`
+}
+
+// apply copies every provided field to the plan
+func (o *planOpts) apply(p *model.Plan) {
+	if o.Name != nil {
+		p.Name = *o.Name
+	}
+	if o.MaxStorage != nil {
+		p.MaxStorage = *o.MaxStorage
+	}
+	if o.MaxUploadSize != nil {
+		p.MaxUploadSize = *o.MaxUploadSize
+	}
+	if o.MaxConcurrentJobs != nil {
+		p.MaxConcurrentJobs = *o.MaxConcurrentJobs
+	}
+	if o.MaxDuration != nil {
+		p.MaxDuration = *o.MaxDuration
+	}
+	if o.OutputFormats != nil {
+		p.OutputFormats = *o.OutputFormats
+	}
+	if o.HLS != nil {
+		p.HLS = *o.HLS
+	}
+	if o.Default != nil {
+		p.IsDefault = *o.Default
+	}
+}
+
+// PlanCreate adds a plan users can be assigned to
+func PlanCreate(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	var data planOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if data.Name == nil || data.MaxStorage == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "A name and a max storage have to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	plan := model.Plan{
+		OutputFormats: model.StringSlice{},
+		CreatedAt:     time.Now().Unix(),
+	}
+	data.apply(&plan)
+
+	if code, err := validators.PlanValidator(&plan); err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	taken, err := planNameTaken(d.DB, plan.Name, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check plan name", zap.Error(err))
+		return
+	}
+
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "A plan with this name exists already",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if plan.IsDefault {
+			if err := clearDefault(tx); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&plan).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to create plan", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// clearDefault unsets the current default plan so another one can take over
+func clearDefault(tx *gorm.DB) error {
+	return tx.
+		Model(model.Plan{}).
+		Where("is_default = ?", true).
+		Update("is_default", false).
+		Error
+}
+
+// planNameTaken reports if another plan uses the name already
+func planNameTaken(db *gorm.DB, name string, exceptID uint) (bool, error) {
+	var count int64
+
+	err := db.
+		Model(model.Plan{}).
+		Where("name = ? AND id != ?", name, exceptID).
+		Count(&count).
+		Error
+
+	return count > 0, err
+}
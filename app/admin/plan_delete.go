@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PlanDelete deletes a plan nobody is assigned to
+func PlanDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	planID := c.Param("id")
+	if planID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No plan ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var plan model.Plan
+	err := d.DB.
+		Where("id = ?", planID).
+		First(&plan).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Plan not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch plan", zap.Error(err))
+		return
+	}
+
+	if plan.IsDefault {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "The default plan can't be deleted",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var users int64
+	err = d.DB.
+		Model(model.User{}).
+		Where("plan_id = ?", plan.ID).
+		Count(&users).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to count plan users", zap.Error(err))
+		return
+	}
+
+	if users > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Move the users of this plan to another plan first",
+			"users":     users,
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if err := d.DB.Delete(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete plan", zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PlanEdit changes the limits of a plan. A new storage limit applies to
+// every user on the plan right away
+func PlanEdit(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	planID := c.Param("id")
+	if planID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No plan ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data planOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var plan model.Plan
+	err := d.DB.
+		Where("id = ?", planID).
+		First(&plan).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Plan not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch plan", zap.Error(err))
+		return
+	}
+
+	// Another plan has to be made the default instead
+	if data.Default != nil && !*data.Default && plan.IsDefault {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "The default plan can only be replaced by making another plan the default",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	wasDefault := plan.IsDefault
+	data.apply(&plan)
+
+	if code, err := validators.PlanValidator(&plan); err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	taken, err := planNameTaken(d.DB, plan.Name, plan.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check plan name", zap.Error(err))
+		return
+	}
+
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "A plan with this name exists already",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if plan.IsDefault && !wasDefault {
+			if err := clearDefault(tx); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(&plan).Error; err != nil {
+			return err
+		}
+
+		return service.SyncPlanStorage(tx, &plan)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update plan", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var planSort = &service.Sort[model.Plan]{
+	Name:   "name",
+	Column: "plans.name",
+	ID:     "plans.id",
+	Key:    func(p *model.Plan) (any, uint) { return p.Name, p.ID },
+}
+
+// PlanList lists every plan
+func PlanList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), planSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	page, err := service.Paginate(d.DB.Model(model.Plan{}), planSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch plans", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
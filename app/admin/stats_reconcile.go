@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// StatsReconcile recomputes the stats of every user right away. With
+// ?verify=true object sizes are checked with S3 first
+func StatsReconcile(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	verify := false
+	if v := c.Query("verify"); v != "" {
+		var err error
+
+		verify, err = strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "verify must be true or false",
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
+	report, err := service.ReconcileStats(d.DB, d.Uploader, verify)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to reconcile stats", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
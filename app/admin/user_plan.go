@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type userPlanOpts struct {
+	PlanID uint `json:"plan_id" binding:"required"`
+}
+
+// UserPlanSet moves a user to another plan. Files over the new storage limit
+// are kept but the user can't upload until there's room again
+func UserPlanSet(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No user ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data userPlanOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "A plan ID has to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var exists int64
+	err := d.DB.
+		Model(model.User{}).
+		Where("id = ?", userID).
+		Count(&exists).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check if user exists", zap.Error(err))
+		return
+	}
+
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":     "User not found",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var plan model.Plan
+	err = d.DB.
+		Where("id = ?", data.PlanID).
+		First(&plan).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Plan not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch plan", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		return service.AssignPlan(tx, &plan, []string{userID})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to assign plan", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
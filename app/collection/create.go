@@ -0,0 +1,58 @@
+package collection
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type collectionOpts struct {
+	Name string `json:"name"`
+}
+
+// CollectionCreate creates a new empty collection
+func CollectionCreate(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var data collectionOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	name, err := validators.LibraryName(data.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	collection := model.Collection{
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if err := d.DB.Create(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to create collection", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
@@ -0,0 +1,68 @@
+package collection
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CollectionDelete removes a collection. Files in it aren't touched
+func CollectionDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	collectionID := c.Param("id")
+	if collectionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No collection ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var collection model.Collection
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, collectionID).
+		First(&collection).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Collection not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch collection", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(model.CollectionFile{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&collection).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete collection", zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package collection
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CollectionEdit renames a collection
+func CollectionEdit(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	collectionID := c.Param("id")
+	if collectionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No collection ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data collectionOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	name, err := validators.LibraryName(data.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var collection model.Collection
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, collectionID).
+		First(&collection).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Collection not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch collection", zap.Error(err))
+		return
+	}
+
+	collection.Name = name
+
+	if err := d.DB.Save(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update collection", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
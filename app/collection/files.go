@@ -0,0 +1,156 @@
+package collection
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type collectionFilesOpts struct {
+	IDs []uint `json:"ids"`
+}
+
+// CollectionAddFiles adds files to a collection. Files the user doesn't own
+// are skipped and reported back
+func CollectionAddFiles(c *gin.Context, d *internal.Deps) {
+	collection, ids, ok := bindCollectionFiles(c, d)
+	if !ok {
+		return
+	}
+
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	owned, err := service.OwnedFileIDs(d.DB, userID, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check file ownership", zap.Error(err))
+		return
+	}
+
+	if len(owned) > 0 {
+		now := time.Now().Unix()
+
+		rows := make([]model.CollectionFile, len(owned))
+		for i, id := range owned {
+			rows[i] = model.CollectionFile{
+				CollectionID: collection.ID,
+				FileID:       id,
+				AddedAt:      now,
+			}
+		}
+
+		err = d.DB.
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&rows).
+			Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to add files to collection", zap.Error(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"added":   owned,
+		"skipped": len(ids) - len(owned),
+	})
+}
+
+// CollectionRemoveFiles removes files from a collection
+func CollectionRemoveFiles(c *gin.Context, d *internal.Deps) {
+	collection, ids, ok := bindCollectionFiles(c, d)
+	if !ok {
+		return
+	}
+
+	requestID := c.MustGet("requestID").(string)
+
+	res := d.DB.
+		Where("collection_id = ? AND file_id IN ?", collection.ID, ids).
+		Delete(model.CollectionFile{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to remove files from collection", zap.Error(res.Error))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": res.RowsAffected})
+}
+
+// bindCollectionFiles reads the file IDs from the body and fetches the
+// collection. The error response is written if ok is false
+func bindCollectionFiles(c *gin.Context, d *internal.Deps) (collection model.Collection, ids []uint, ok bool) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	collectionID := c.Param("id")
+	if collectionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No collection ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data collectionFilesOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if len(data.IDs) == 0 || len(data.IDs) > validators.MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Between 1 and 1000 file IDs have to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, collectionID).
+		First(&collection).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Collection not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch collection", zap.Error(err))
+		return
+	}
+
+	return collection, data.IDs, true
+}
@@ -0,0 +1,62 @@
+package collection
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var collectionSort = &service.Sort[model.Collection]{
+	Name:   "name",
+	Column: "collections.name",
+	ID:     "collections.id",
+	Key:    func(col *model.Collection) (any, uint) { return col.Name, col.ID },
+}
+
+// CollectionList returns the collections of a user along with how many
+// files each of them has
+func CollectionList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), collectionSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Model(model.Collection{}).
+		Where("user_id = ?", userID).
+		Select("collections.*, (SELECT COUNT(*) FROM collection_files JOIN files ON files.id = collection_files.file_id WHERE collection_files.collection_id = collections.id AND files.deleted_at IS NULL) AS file_count")
+
+	page, err := service.Paginate(query, collectionSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch collections", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -43,7 +43,51 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	if code, err := validators.ProcessingOptsValidator(&opts, float64(opts.File.Size)); err != nil {
+	// The form is bound again on top of the preset so explicit fields win
+	if id := opts.PresetID; id != 0 {
+		opts = validators.ProcessingOptions{}
+
+		if err := service.LoadPreset(d.DB, userID, id, &opts); err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":     "Preset not found",
+					"requestID": requestID,
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to load preset", zap.Error(err))
+			return
+		}
+
+		if err := c.ShouldBindWith(&opts, binding.FormMultipart); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Failed to read form body",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to read form body", zap.Error(err))
+			return
+		}
+	}
+
+	plan, err := service.UserPlan(d.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch user plan", zap.Error(err))
+		return
+	}
+
+	if code, err := validators.ProcessingOptsValidator(&opts, float64(opts.File.Size), plan); err != nil {
 		c.JSON(code, gin.H{
 			"error":     err.Error(),
 			"requestID": requestID,
@@ -51,7 +95,50 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	code, f, err := validators.FileValidator(opts.File, nil, "")
+	// Only used when the result is saved to the cloud
+	expiresAt, err := validators.FormExpiryValidator(c.PostForm("expiresIn"), c.PostForm("expiresAt"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if opts.SubtitleID != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Subtitles can only be applied to stored files",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if id := opts.WatermarkID; id != 0 {
+		wm, wmPath, err := service.ResolveWatermark(c.Request.Context(), d.DB, d.Uploader, userID, id)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":     "Watermark not found",
+					"requestID": requestID,
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to resolve watermark", zap.Error(err))
+			return
+		}
+		defer os.Remove(wmPath)
+
+		opts.Watermark = wm
+		opts.WatermarkPath = wmPath
+	}
+
+	code, f, err := validators.FileValidator(opts.File, nil, "", plan)
 	if err != nil {
 		if code == http.StatusInternalServerError {
 			zap.L().Error("Failed to validate file", zap.Error(err))
@@ -91,8 +178,45 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	// The length of outputs trimmed on both ends was checked with the options already
+	if opts.TrimStart > 0 || (plan.MaxDuration > 0 && opts.TrimEnd <= 0) {
+		duration, err := service.GetDuration(tempFile.Name())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Failed to read the video duration",
+				"requestID": requestID,
+			})
+
+			zap.L().Warn("Failed to probe uploaded file", zap.Error(err))
+			return
+		}
+
+		if code, err := validators.TrimValidator(&opts, duration); err != nil {
+			c.JSON(code, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if opts.TrimEnd <= 0 {
+			if code, err := validators.DurationValidator(duration-opts.TrimStart, plan); err != nil {
+				c.JSON(code, gin.H{
+					"error":     err.Error(),
+					"requestID": requestID,
+				})
+				return
+			}
+		}
+	}
+
 	if !opts.SaveToCloud {
-		c.Header("Content-Type", "video/mp4")
+		contentType := "video/mp4"
+		if opts.AudioOnly {
+			contentType = "audio/mp4"
+		}
+
+		c.Header("Content-Type", contentType)
 		c.Header("Transfer-Encoding", "chunked")
 
 		ctxReq := c.Request.Context()
@@ -115,6 +239,14 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 			Done:     done,
 		})
 		if err != nil {
+			if errors.Is(err, service.ErrTooManyJobs) {
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error":     "Your plan doesn't allow more jobs at once. Wait for one to finish",
+					"requestID": requestID,
+				})
+				return
+			}
+
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"error":     "Job queue is full. Please wait a moment before trying again",
 				"requestID": requestID,
@@ -176,6 +308,14 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 		Done:     done,
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrTooManyJobs) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":     "Your plan doesn't allow more jobs at once. Wait for one to finish",
+				"requestID": requestID,
+			})
+			return
+		}
+
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"error":     "Job queue is full. Please wait a moment before trying again",
 			"requestID": requestID,
@@ -215,11 +355,21 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	fileEnt.ExpiresAt = expiresAt
+
 	err = d.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&fileEnt).Error; err != nil {
 			return err
 		}
 
+		if err := service.AcquireBlob(tx, fileEnt.FileKey, fileEnt.SHA256, fileEnt.Size); err != nil {
+			return err
+		}
+
+		if err := service.ReleaseHold(tx, fileEnt.FileKey); err != nil {
+			return err
+		}
+
 		if err := tx.
 			Model(model.Stats{}).
 			Where("user_id = ?", userID).
@@ -240,8 +390,14 @@ func FFmpegProcess(c *gin.Context, d *internal.Deps) {
 		})
 
 		zap.L().Error("Database transaction failed", zap.String("requestID", requestID), zap.Error(err))
+
+		if err := d.Uploader.Abandon(fileEnt); err != nil {
+			zap.L().Error("Failed to clean up unsaved upload", zap.Error(err))
+		}
 		return
 	}
 
+	service.PostUpload(d.DB, d.Uploader, *fileEnt)
+
 	c.Status(http.StatusOK)
 }
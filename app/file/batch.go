@@ -0,0 +1,163 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type batchResult struct {
+	ID    uint   `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// FileBatch applies one operation to many files at once. Files can be
+// deleted, made private or public, tagged, untagged or moved to a folder.
+// Everything runs in a single transaction and files the user doesn't own are
+// reported in the results instead of failing the whole batch
+func FileBatch(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var opts validators.BatchOptions
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if code, err := validators.BatchValidator(&opts); err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	// Files can only be moved into folders the user owns, the files
+	// themselves are checked below like every other operation
+	var folderID *uint
+	if opts.Operation == "move" && *opts.FolderID != 0 {
+		err := service.CheckFolder(d.DB, userID, *opts.FolderID)
+		if err != nil {
+			if err == service.ErrFolderNotOwned {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":     "Folder not found",
+					"requestID": requestID,
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to check folder ownership", zap.Error(err))
+			return
+		}
+
+		folderID = opts.FolderID
+	}
+
+	slices.Sort(opts.IDs)
+	opts.IDs = slices.Compact(opts.IDs)
+
+	var files []model.File
+	err := d.DB.
+		Where("user_id = ? AND id IN ?", userID, opts.IDs).
+		Scopes(service.NotExpired).
+		Find(&files).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch files from db", zap.Error(err))
+		return
+	}
+
+	results := make(map[uint]*batchResult, len(opts.IDs))
+	for _, id := range opts.IDs {
+		results[id] = &batchResult{ID: id, Error: "File not found"}
+	}
+
+	found := make([]uint, len(files))
+	for i, f := range files {
+		found[i] = f.ID
+		results[f.ID].OK = true
+		results[f.ID].Error = ""
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if len(files) == 0 {
+			return nil
+		}
+
+		switch opts.Operation {
+		case "delete":
+			return service.TrashFiles(tx, found)
+		case "private":
+			return tx.
+				Model(model.File{}).
+				Where("id IN ?", found).
+				Update("private", *opts.Private).
+				Error
+		case "move":
+			return tx.
+				Model(model.File{}).
+				Where("id IN ?", found).
+				Update("folder_id", folderID).
+				Error
+		case "remove_tags":
+			return service.RemoveFileTags(tx, userID, found, opts.Tags)
+		}
+
+		tags, err := service.EnsureTags(tx, userID, opts.Tags)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range found {
+			err := service.AddFileTags(tx, id, tags)
+			if err == service.ErrTooManyTags {
+				results[id].OK = false
+				results[id].Error = "Too many tags"
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Batch operation failed", zap.String("operation", opts.Operation), zap.Error(err))
+		return
+	}
+
+	out := make([]*batchResult, len(opts.IDs))
+	for i, id := range opts.IDs {
+		out[i] = results[id]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": out})
+}
@@ -0,0 +1,53 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// FileDuplicates returns groups of a user's files with the same or, when
+// fingerprints are enabled, similar content. Exact groups are computed over
+// the whole library so the page is never split, similar ones over the newest
+// fingerprinted files
+func FileDuplicates(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	groups, err := service.FindDuplicates(d.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to find duplicate files", zap.Error(err))
+		return
+	}
+
+	for _, g := range groups {
+		if err := service.LoadTags(d.DB, g.Files); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to load file tags", zap.Error(err))
+			return
+		}
+
+		for i := range g.Files {
+			g.Files[i].VersionKeys()
+		}
+	}
+
+	total := int64(len(groups))
+
+	c.JSON(http.StatusOK, service.Page[service.DuplicateGroup]{
+		Items:         groups,
+		TotalEstimate: &total,
+	})
+}
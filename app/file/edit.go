@@ -7,20 +7,27 @@ import (
 	"bitwise74/video-api/pkg/util"
 	"bitwise74/video-api/pkg/validators"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"os"
 	"path"
-	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
+const maxDescriptionLength = 5000
+
 type fileEditOpts struct {
 	NewName           *string                       `json:"name,omitempty"`
+	NewDescription    *string                       `json:"description,omitempty"`
+	ExpiresIn         *int64                        `json:"expires_in,omitempty"` // TTL in seconds
+	ExpiresAt         *int64                        `json:"expires_at,omitempty"` // Unix timestamp, 0 removes the expiry
 	ProcessingOptions *validators.ProcessingOptions `json:"processing_options,omitempty"`
 }
 
@@ -38,8 +45,18 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	// Kept around so the body can be decoded again on top of a preset
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Failed to read request body",
+			"requestID": requestID,
+		})
+		return
+	}
+
 	var data fileEditOpts
-	if err := c.BindJSON(&data); err != nil {
+	if err := json.Unmarshal(body, &data); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":     "Malformed or invalid JSON request body",
 			"requestID": requestID,
@@ -49,7 +66,7 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	if data.NewName == nil && data.ProcessingOptions == nil {
+	if data.NewName == nil && data.NewDescription == nil && data.ExpiresIn == nil && data.ExpiresAt == nil && data.ProcessingOptions == nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":     "No edit options provided",
 			"requestID": requestID,
@@ -65,9 +82,32 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	if data.NewDescription != nil && utf8.RuneCountInString(*data.NewDescription) > maxDescriptionLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Description can be at most 5000 characters long",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	clearExpiry := data.ExpiresIn == nil && data.ExpiresAt != nil && *data.ExpiresAt == 0
+
+	var expiresAt *int64
+	if !clearExpiry {
+		expiresAt, err = validators.ExpiryValidator(data.ExpiresIn, data.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
 	var file model.File
-	err := d.DB.
+	err = d.DB.
 		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
 		First(&file).
 		Error
 	if err != nil {
@@ -93,10 +133,71 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 		file.OriginalName = *data.NewName
 	}
 
-	originalSize := file.Size
+	if data.NewDescription != nil {
+		file.Description = *data.NewDescription
+	}
+
+	if clearExpiry {
+		file.ExpiresAt = nil
+	} else if expiresAt != nil {
+		file.ExpiresAt = expiresAt
+	}
+
+	var newVersion *model.FileVersion
 
 	if data.ProcessingOptions != nil {
-		if code, err := validators.ProcessingOptsValidator(data.ProcessingOptions, float64(file.Size)); err != nil {
+		if id := data.ProcessingOptions.PresetID; id != 0 {
+			opts := validators.ProcessingOptions{}
+
+			if err := service.LoadPreset(d.DB, userID, id, &opts); err != nil {
+				if err == gorm.ErrRecordNotFound {
+					c.JSON(http.StatusNotFound, gin.H{
+						"error":     "Preset not found",
+						"requestID": requestID,
+					})
+					return
+				}
+
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to load preset", zap.Error(err))
+				return
+			}
+
+			// Decoding the body again on top of the preset makes explicit fields win
+			data.ProcessingOptions = &opts
+			if err := json.Unmarshal(body, &data); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":     "Malformed or invalid JSON request body",
+					"requestID": requestID,
+				})
+				return
+			}
+		}
+
+		plan, err := service.UserPlan(d.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to fetch user plan", zap.Error(err))
+			return
+		}
+
+		if code, err := validators.ProcessingOptsValidator(data.ProcessingOptions, float64(file.Size), plan); err != nil {
+			c.JSON(code, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if code, err := validators.TrimValidator(data.ProcessingOptions, file.Duration); err != nil {
 			c.JSON(code, gin.H{
 				"error":     err.Error(),
 				"requestID": requestID,
@@ -104,6 +205,88 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 			return
 		}
 
+		if file.Format != "video/mp4" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Only videos can be processed",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if data.ProcessingOptions.AudioOnly {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Audio-only exports can't replace a video",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		if id := data.ProcessingOptions.SubtitleID; id != 0 {
+			var sub model.Subtitle
+			err := d.DB.
+				Where("user_id = ? AND file_id = ? AND id = ?", userID, file.ID, id).
+				First(&sub).
+				Error
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					c.JSON(http.StatusNotFound, gin.H{
+						"error":     "Subtitle not found",
+						"requestID": requestID,
+					})
+					return
+				}
+
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to fetch subtitle from db", zap.Error(err))
+				return
+			}
+
+			subPath := path.Join(os.TempDir(), util.RandStr(10)+".vtt")
+			defer os.Remove(subPath)
+
+			if err := d.Uploader.GetFile(c.Request.Context(), sub.Key, subPath); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to download subtitle", zap.Error(err))
+				return
+			}
+
+			data.ProcessingOptions.SubtitlePath = subPath
+			data.ProcessingOptions.SubtitleLanguage = sub.Language
+		}
+
+		if id := data.ProcessingOptions.WatermarkID; id != 0 {
+			wm, wmPath, err := service.ResolveWatermark(c.Request.Context(), d.DB, d.Uploader, userID, id)
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					c.JSON(http.StatusNotFound, gin.H{
+						"error":     "Watermark not found",
+						"requestID": requestID,
+					})
+					return
+				}
+
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":     "Internal server error",
+					"requestID": requestID,
+				})
+
+				zap.L().Error("Failed to resolve watermark", zap.Error(err))
+				return
+			}
+			defer os.Remove(wmPath)
+
+			data.ProcessingOptions.Watermark = wm
+			data.ProcessingOptions.WatermarkPath = wmPath
+		}
+
 		// Download the video to process
 		temp, err := os.CreateTemp("", "process-*.mp4")
 		if err != nil {
@@ -194,6 +377,14 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 			Done:     done,
 		})
 		if err != nil {
+			if errors.Is(err, service.ErrTooManyJobs) {
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error":     "Your plan doesn't allow more jobs at once. Wait for one to finish",
+					"requestID": requestID,
+				})
+				return
+			}
+
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"error":     "FFmpeg job queue is full. Please try again later",
 				"requestID": requestID,
@@ -210,9 +401,42 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 			return
 		}
 
-		keyNoExt := strings.TrimSuffix(file.FileKey, path.Ext(file.FileKey))
+		stat, err := tempProcessed.Stat()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to stat processed file", zap.Error(err))
+			return
+		}
 
-		newFile, err := d.Uploader.Do(tempProcessed.Name(), file.OriginalName, userID, keyNoExt)
+		// Previous versions are kept so the edit needs room for a whole new file
+		var stats model.Stats
+		err = d.DB.
+			Where("user_id = ?", userID).
+			First(&stats).
+			Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to fetch user stats", zap.Error(err))
+			return
+		}
+
+		if stats.UsedStorage+stat.Size() > stats.MaxStorage {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":     "Not enough storage left for a new version. Prune old versions to free up space",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		newFile, err := d.Uploader.Do(tempProcessed.Name(), file.OriginalName, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":     "Internal server error",
@@ -225,32 +449,59 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 
 		zap.L().Debug("New object put to s3")
 
-		file.Duration = newFile.Duration
-		file.Size = newFile.Size
+		newVersion = &model.FileVersion{
+			FileKey:  newFile.FileKey,
+			ThumbKey: newFile.ThumbKey,
+			Size:     newFile.Size,
+			SHA256:   newFile.SHA256,
+			Duration: newFile.Duration,
+		}
 	}
 
-	file.Version++
-
 	err = d.DB.Transaction(
 		func(tx *gorm.DB) error {
-			err := tx.Updates(file).Error
+			if newVersion == nil {
+				file.Version++
+
+				// Selected explicitly so the description and expiry can be cleared
+				return tx.
+					Model(&file).
+					Select("original_name", "description", "version", "expires_at").
+					Updates(file).
+					Error
+			}
+
+			if err := service.SnapshotOriginal(tx, &file); err != nil {
+				return err
+			}
+
+			stale, err := service.SwitchVersion(tx, &file, newVersion)
 			if err != nil {
 				return err
 			}
 
-			if originalSize != file.Size {
-				err := tx.
-					Model(model.Stats{}).
-					Where("user_id = ?", userID).
-					Updates(map[string]any{
-						"used_storage": gorm.Expr("used_storage - ?", originalSize-file.Size),
-					}).Error
-				if err != nil {
-					return err
-				}
+			if err := service.EnqueueDeletes(tx, stale); err != nil {
+				return err
 			}
 
-			return nil
+			if _, err := service.AddVersion(tx, &file, data.ProcessingOptions); err != nil {
+				return err
+			}
+
+			if err := service.ReleaseHold(tx, newVersion.FileKey); err != nil {
+				return err
+			}
+
+			if err := tx.Save(&file).Error; err != nil {
+				return err
+			}
+
+			return tx.
+				Model(model.Stats{}).
+				Where("user_id = ?", userID).
+				Updates(map[string]any{
+					"used_storage": gorm.Expr("used_storage + ?", file.Size),
+				}).Error
 		},
 	)
 	if err != nil {
@@ -260,8 +511,23 @@ func FileEdit(c *gin.Context, d *internal.Deps) {
 		})
 
 		zap.L().Error("Failed to commit transaction after file edit", zap.Error(err))
+
+		if newVersion != nil {
+			abandoned := &model.File{FileKey: newVersion.FileKey, ThumbKey: newVersion.ThumbKey}
+			if err := d.Uploader.Abandon(abandoned); err != nil {
+				zap.L().Error("Failed to clean up edited video", zap.Error(err))
+			}
+		}
 		return
 	}
 
+	if newVersion != nil {
+		service.PostUpload(d.DB, d.Uploader, file)
+	}
+
+	if err := service.LoadFileTags(d.DB, &file); err != nil {
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+	}
+
 	c.JSON(http.StatusOK, file)
 }
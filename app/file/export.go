@@ -0,0 +1,262 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var exportFormats = map[string]string{
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// FileExport clips part of a video into a GIF or an animated WebP. The result
+// is either streamed back or saved as a new file
+func FileExport(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	format := c.Param("format")
+	contentType, ok := exportFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Unsupported export format, use gif or webp",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var opts validators.ExportOptions
+	if err := c.BindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Malformed or invalid JSON request body",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to read JSON body", zap.Error(err))
+		return
+	}
+
+	var file model.File
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	plan, err := service.UserPlan(d.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch user plan", zap.Error(err))
+		return
+	}
+
+	if !plan.AllowsFormat(format) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":     "Your plan doesn't allow " + format + " exports",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if code, err := validators.ExportOptsValidator(&opts, file.Duration); err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	input := os.Getenv("CLOUDFRONT_URL") + "/" + file.FileKey + "?v=" + strconv.Itoa(file.Version)
+
+	out, err := service.MakeAnimation(input, format, &opts, d.JobQueue, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrQueueFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":     "Job queue is full. Please wait a moment before trying again",
+				"requestID": requestID,
+			})
+		case errors.Is(err, service.ErrTooManyJobs):
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":     "Your plan doesn't allow more jobs at once. Wait for one to finish",
+				"requestID": requestID,
+			})
+		case errors.Is(err, service.ErrExportTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":     "Export doesn't fit into the max size. Try a shorter clip or a smaller width",
+				"requestID": requestID,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to export file", zap.String("format", format), zap.Error(err))
+		}
+		return
+	}
+
+	name := strings.TrimSuffix(file.OriginalName, path.Ext(file.OriginalName)) + "." + format
+
+	if !opts.SaveToCloud {
+		defer os.Remove(out)
+
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		c.Header("Content-Type", contentType)
+		c.File(out)
+		return
+	}
+
+	stat, err := os.Stat(out)
+	if err != nil {
+		os.Remove(out)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to stat export", zap.Error(err))
+		return
+	}
+
+	var stats model.Stats
+	err = d.DB.
+		Where("user_id = ?", userID).
+		First(&stats).
+		Error
+	if err != nil {
+		os.Remove(out)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch user stats", zap.Error(err))
+		return
+	}
+
+	if stats.UsedStorage+stat.Size() > stats.MaxStorage {
+		os.Remove(out)
+
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     validators.ErrNoSpace.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	// Animated WebP can't be decoded by every ffmpeg build and a GIF only has
+	// a reduced palette so the thumbnail is made from the source video
+	thumbPath, err := service.MakeThumbnailAt(input, opts.Start, d.JobQueue, userID)
+	if err != nil {
+		os.Remove(out)
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to make export thumbnail", zap.Error(err))
+		return
+	}
+
+	// Uploader removes both files once it's done
+	fileEnt, err := d.Uploader.DoPrepared(out, name, userID, contentType, &service.Prepared{
+		ThumbPath: thumbPath,
+		Duration:  opts.End - opts.Start,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload export to S3", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&fileEnt).Error; err != nil {
+			return err
+		}
+
+		if err := service.AcquireBlob(tx, fileEnt.FileKey, fileEnt.SHA256, fileEnt.Size); err != nil {
+			return err
+		}
+
+		if err := service.ReleaseHold(tx, fileEnt.FileKey); err != nil {
+			return err
+		}
+
+		return tx.
+			Model(model.Stats{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]any{
+				"used_storage":   gorm.Expr("used_storage + ?", fileEnt.Size),
+				"uploaded_files": gorm.Expr("uploaded_files + ?", 1),
+			}).
+			Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Database transaction failed", zap.String("requestID", requestID), zap.Error(err))
+
+		if err := d.Uploader.Abandon(fileEnt); err != nil {
+			zap.L().Error("Failed to clean up unsaved upload", zap.Error(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, fileEnt)
+}
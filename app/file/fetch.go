@@ -3,6 +3,7 @@ package file
 import (
 	"bitwise74/video-api/internal"
 	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -28,6 +29,7 @@ func FileFetch(c *gin.Context, d *internal.Deps) {
 
 	err := d.DB.
 		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
 		First(&file).
 		Error
 	if err != nil {
@@ -49,5 +51,15 @@ func FileFetch(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	if err := service.LoadFileTags(d.DB, &file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+		return
+	}
+
 	c.JSON(http.StatusOK, file)
 }
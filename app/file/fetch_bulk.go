@@ -3,125 +3,100 @@ package file
 import (
 	"bitwise74/video-api/internal"
 	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
 	"net/http"
-	"slices"
-	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 // AZ = A - Z as in alphabetic same for ZA
-var validSortOpts = []string{"newest", "oldest", "az", "za", "size-asc", "size-desc"}
+var fileSorts = map[string]*service.Sort[model.File]{
+	"newest":    fileSort("newest", "files.created_at", true, func(f *model.File) any { return f.CreatedAt }),
+	"oldest":    fileSort("oldest", "files.created_at", false, func(f *model.File) any { return f.CreatedAt }),
+	"az":        fileSort("az", "files.original_name", false, func(f *model.File) any { return f.OriginalName }),
+	"za":        fileSort("za", "files.original_name", true, func(f *model.File) any { return f.OriginalName }),
+	"size-asc":  fileSort("size-asc", "files.size", false, func(f *model.File) any { return f.Size }),
+	"size-desc": fileSort("size-desc", "files.size", true, func(f *model.File) any { return f.Size }),
+}
+
+func fileSort(name, column string, desc bool, key func(*model.File) any) *service.Sort[model.File] {
+	return &service.Sort[model.File]{
+		Name:   name,
+		Column: column,
+		ID:     "files.id",
+		Desc:   desc,
+		Key:    func(f *model.File) (any, uint) { return key(f), f.ID },
+	}
+}
 
+// FileFetchBulk returns a page of a user's files. Pages are walked with the
+// next_cursor of the previous response which only works with the same sort
 func FileFetchBulk(c *gin.Context, d *internal.Deps) {
 	requestID := c.MustGet("requestID").(string)
 	userID := c.MustGet("userID").(string)
 
-	pageStr := c.DefaultQuery("page", "0")
-	page, err := strconv.Atoi(pageStr)
+	limit, err := validators.LimitValidator(c.Query("limit"), 10)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Page must be a number",
+			"error":     err.Error(),
 			"requestID": requestID,
 		})
 		return
 	}
 
-	if page < 0 {
+	sort, ok := fileSorts[strings.ToLower(c.DefaultQuery("sort", "newest"))]
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Page can't be negative",
+			"error":     "Invalid sorting option",
 			"requestID": requestID,
 		})
 		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "10")
-	limit, err := strconv.Atoi(limitStr)
+	cursor, err := service.DecodeCursor(c.Query("cursor"), sort.Name)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Limit must be a number",
+			"error":     "Invalid cursor",
 			"requestID": requestID,
 		})
 		return
 	}
 
-	if limit <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Limit must be greater than 0",
-			"requestID": requestID,
-		})
-		return
-	}
-
-	if limit > 250 {
+	query, err := applyLibraryFilters(c, d.DB.Model(model.File{}).Where("files.user_id = ?", userID).Scopes(service.NotExpired), userID)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Limit must be smaller than 250",
+			"error":     err.Error(),
 			"requestID": requestID,
 		})
 		return
 	}
 
-	sort := strings.ToLower(c.DefaultQuery("sort", "newest"))
-	if !slices.Contains(validSortOpts, sort) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Invalid sorting option",
+	page, err := service.Paginate(query, sort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
 			"requestID": requestID,
 		})
+		zap.L().Error("Failed to lookup user files", zap.Error(err))
 		return
 	}
 
-	order := ""
-
-	switch sort {
-	case "newest":
-		order = "created_at desc"
-	case "oldest":
-		order = "created_at asc"
-	case "az":
-		order = "name"
-	case "za":
-		order = "name desc"
-	case "size-asc":
-		order = "size asc"
-	case "size-desc":
-		order = "size desc"
-	}
-
-	offset := page * limit
-	var entries []model.File
-
-	err = d.DB.
-		Where("user_id = ?", userID).
-		Order(order).
-		Offset(offset).
-		Limit(limit).
-		Find(&entries).
-		Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":     "No results",
-				"requestID": requestID,
-			})
-			return
-		}
-
+	if err := service.LoadTags(d.DB, page.Items); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":     "Internal server error",
 			"requestID": requestID,
 		})
-		zap.L().Error("Failed to lookup user files", zap.Error(err))
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
 		return
 	}
 
-	for i, file := range entries {
-		version := strconv.Itoa(file.Version)
-		entries[i].FileKey = file.FileKey + "?v=" + version
-		entries[i].ThumbKey = file.ThumbKey + "?v=" + version
+	for i := range page.Items {
+		page.Items[i].VersionKeys()
 	}
 
-	c.JSON(http.StatusOK, entries)
+	c.JSON(http.StatusOK, page)
 }
@@ -0,0 +1,112 @@
+package file
+
+import (
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// applyLibraryFilters narrows a file query down to a folder, a collection
+// and/or tags. folderId=root only matches files outside of any folder. Tags
+// are passed as repeated tag parameters and tagMode=all only matches files
+// that have every one of them
+func applyLibraryFilters(c *gin.Context, q *gorm.DB, userID string) (*gorm.DB, error) {
+	if folder := c.Query("folderId"); folder != "" {
+		if folder == "root" {
+			q = q.Where("files.folder_id IS NULL")
+		} else {
+			id, err := strconv.ParseUint(folder, 10, 64)
+			if err != nil {
+				return nil, errors.New("Folder ID must be a number or root")
+			}
+
+			q = q.Where("files.folder_id = ?", id)
+		}
+	}
+
+	if collection := c.Query("collectionId"); collection != "" {
+		id, err := strconv.ParseUint(collection, 10, 64)
+		if err != nil {
+			return nil, errors.New("Collection ID must be a number")
+		}
+
+		q = q.Where(
+			"files.id IN (SELECT collection_files.file_id FROM collection_files JOIN collections ON collections.id = collection_files.collection_id WHERE collections.id = ? AND collections.user_id = ?)",
+			id, userID,
+		)
+	}
+
+	tags := c.QueryArray("tag")
+	if len(tags) == 0 {
+		return q, nil
+	}
+
+	for i, t := range tags {
+		t, err := validators.NormalizeTag(t)
+		if err != nil {
+			return nil, err
+		}
+		tags[i] = t
+	}
+
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+
+	sub := "SELECT file_tags.file_id FROM file_tags JOIN tags ON tags.id = file_tags.tag_id WHERE tags.user_id = ? AND tags.name IN ?"
+
+	switch c.DefaultQuery("tagMode", "any") {
+	case "any":
+		q = q.Where("files.id IN ("+sub+")", userID, tags)
+	case "all":
+		q = q.Where("files.id IN ("+sub+" GROUP BY file_tags.file_id HAVING COUNT(*) = ?)", userID, tags, len(tags))
+	default:
+		return nil, errors.New("Tag mode must be either any or all")
+	}
+
+	return q, nil
+}
+
+// applySearchFilters narrows a file query down by creation date (unix
+// seconds), duration (seconds), size (bytes) and privacy
+func applySearchFilters(c *gin.Context, q *gorm.DB) (*gorm.DB, error) {
+	ranges := []struct {
+		param  string
+		clause string
+	}{
+		{"createdAfter", "files.created_at >= ?"},
+		{"createdBefore", "files.created_at <= ?"},
+		{"minDuration", "files.duration >= ?"},
+		{"maxDuration", "files.duration <= ?"},
+		{"minSize", "files.size >= ?"},
+		{"maxSize", "files.size <= ?"},
+	}
+
+	for _, r := range ranges {
+		v := c.Query(r.param)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 {
+			return nil, errors.New(r.param + " must be a positive number")
+		}
+
+		q = q.Where(r.clause, n)
+	}
+
+	if v := c.Query("private"); v != "" {
+		private, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("private must be either true or false")
+		}
+
+		q = q.Where("files.private = ?", private)
+	}
+
+	return q, nil
+}
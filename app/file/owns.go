@@ -3,6 +3,7 @@ package file
 import (
 	"bitwise74/video-api/internal"
 	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -27,6 +28,7 @@ func FileOwns(c *gin.Context, d *internal.Deps) {
 	err := d.DB.
 		Model(model.File{}).
 		Where("id = ? AND user_id = ?", fileID, userID).
+		Scopes(service.NotExpired).
 		Select("count(*) > 0").
 		Find(&owns).
 		Error
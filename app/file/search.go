@@ -3,59 +3,118 @@ package file
 import (
 	"bitwise74/video-api/internal"
 	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
 	"net/http"
-	"slices"
-	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-var validLimits = []int{10, 20, 50, 100, 250}
+type searchResult struct {
+	model.File
+	Snippet string  `json:"snippet,omitempty"` // Matched text with <mark> around the hits
+	Rank    float64 `json:"-"`
+}
+
+// Relevance is only available with full-text search, the other sorts are
+// the same as the ones of FileFetchBulk
+var relevanceSort = &service.Sort[searchResult]{
+	Name:   "relevance",
+	Column: "files_fts.rank",
+	ID:     "files.id",
+	Key:    func(r *searchResult) (any, uint) { return r.Rank, r.ID },
+}
+
+func searchSort(s *service.Sort[model.File]) *service.Sort[searchResult] {
+	return &service.Sort[searchResult]{
+		Name:   s.Name,
+		Column: s.Column,
+		ID:     s.ID,
+		Desc:   s.Desc,
+		Key:    func(r *searchResult) (any, uint) { return s.Key(&r.File) },
+	}
+}
 
+// FileSearch searches the names, tags, descriptions and subtitles of a
+// user's files. Words are matched as prefixes and results are ranked by
+// relevance unless another sort is asked for. Without a query only the
+// filters are applied and the newest files come first
 func FileSearch(c *gin.Context, d *internal.Deps) {
 	requestID := c.MustGet("requestID").(string)
 	userID := c.MustGet("userID").(string)
 
-	searchQuery := strings.ToLower(c.Query("query"))
-	if searchQuery == "" {
+	searchQuery := strings.TrimSpace(c.Query("query"))
+	match := service.MatchQuery(searchQuery)
+	fullText := match != "" && d.FullTextSearch
+
+	limit, err := validators.LimitValidator(c.Query("limit"), 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	defaultSort := "newest"
+	if fullText {
+		defaultSort = "relevance"
+	}
+
+	var sort *service.Sort[searchResult]
+
+	sortName := strings.ToLower(c.DefaultQuery("sort", defaultSort))
+	if s, ok := fileSorts[sortName]; ok {
+		sort = searchSort(s)
+	} else if sortName == "relevance" && fullText {
+		sort = relevanceSort
+	} else {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "No search query provided",
+			"error":     "Invalid sorting option",
 			"requestID": requestID,
 		})
 		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "10")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || !slices.Contains(validLimits, limit) {
+	cursor, err := service.DecodeCursor(c.Query("cursor"), sort.Name)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Invalid limit provided",
+			"error":     "Invalid cursor",
 			"requestID": requestID,
 		})
 		return
 	}
 
-	pageStr := c.DefaultQuery("page", "0")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 0 {
+	// The model makes the count of Paginate skip trashed files too, the
+	// snippet and rank are only selected with full-text search
+	base := d.DB.
+		Model(model.File{}).
+		Select("files.*").
+		Where("files.user_id = ?", userID).
+		Scopes(service.NotExpired)
+
+	query, err := applyLibraryFilters(c, base, userID)
+	if err == nil {
+		query, err = applySearchFilters(c, query)
+	}
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Invalid page provided",
+			"error":     err.Error(),
 			"requestID": requestID,
 		})
 		return
 	}
 
-	var results []model.File
+	switch {
+	case fullText:
+		query = service.MatchFiles(query, userID, searchQuery)
+	case searchQuery != "":
+		query = service.LikeFiles(query, searchQuery)
+	}
 
-	err = d.DB.
-		Where("user_id = ? AND original_name LIKE ?", userID, "%"+searchQuery+"%").
-		Order("created_at desc").
-		Offset(page * limit).
-		Limit(limit).
-		Find(&results).
-		Error
+	page, err := service.Paginate(query, sort, cursor, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":     "Internal server error",
@@ -66,11 +125,25 @@ func FileSearch(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	for i, file := range results {
-		version := strconv.Itoa(file.Version)
-		results[i].FileKey = file.FileKey + "?v=" + version
-		results[i].ThumbKey = file.ThumbKey + "?v=" + version
+	files := make([]model.File, len(page.Items))
+	for i := range page.Items {
+		files[i] = page.Items[i].File
+	}
+
+	if err := service.LoadTags(d.DB, files); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+		return
+	}
+
+	for i := range page.Items {
+		page.Items[i].File = files[i]
+		page.Items[i].VersionKeys()
 	}
 
-	c.JSON(http.StatusOK, results)
+	c.JSON(http.StatusOK, page)
 }
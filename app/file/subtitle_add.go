@@ -0,0 +1,131 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FileSubtitleAdd attaches an SRT or VTT subtitle track to a file. Tracks
+// are always stored as WebVTT next to the video
+func FileSubtitleAdd(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No subtitle file provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	language := c.PostForm("language")
+	label := strings.TrimSpace(c.PostForm("label"))
+	if label == "" {
+		label = language
+	}
+
+	code, data, format, err := validators.SubtitleValidator(fh, language, label)
+	if err != nil {
+		if code == http.StatusInternalServerError {
+			zap.L().Error("Failed to validate subtitle file", zap.Error(err))
+			err = errors.New("Internal server error")
+		}
+
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	vtt, err := service.ToWebVTT(data, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	sub := model.Subtitle{
+		FileID:    file.ID,
+		UserID:    userID,
+		Language:  language,
+		Label:     label,
+		Key:       service.KeyPrefix(&file) + "_sub_" + util.RandStr(6) + ".vtt",
+		Text:      service.SubtitleText(vtt),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	if err := d.Uploader.PutBytes(ctx, vtt, sub.Key, "text/vtt"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload subtitle to S3", zap.Error(err))
+		return
+	}
+
+	if err := d.DB.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to save subtitle", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
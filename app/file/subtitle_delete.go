@@ -0,0 +1,70 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FileSubtitleDelete removes a subtitle track from a file
+func FileSubtitleDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	subID := c.Param("subID")
+	if fileID == "" || subID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file or subtitle ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var sub model.Subtitle
+	err := d.DB.
+		Where("user_id = ? AND file_id = ? AND id = ?", userID, fileID, subID).
+		First(&sub).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Subtitle not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch subtitle", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&sub).Error; err != nil {
+			return err
+		}
+
+		return service.EnqueueDeletes(tx, []string{sub.Key})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete subtitle", zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var subtitleSort = &service.Sort[model.Subtitle]{
+	Name:   "language",
+	Column: "subtitles.language",
+	ID:     "subtitles.id",
+	Key:    func(s *model.Subtitle) (any, uint) { return s.Language, s.ID },
+}
+
+// FileSubtitles lists the subtitle tracks attached to a file
+func FileSubtitles(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), subtitleSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Model(model.Subtitle{}).
+		Where("user_id = ? AND file_id = ?", userID, fileID)
+
+	page, err := service.Paginate(query, subtitleSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch subtitles", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
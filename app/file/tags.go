@@ -0,0 +1,153 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type fileTagsOpts struct {
+	Tags []string `json:"tags"`
+}
+
+// FileTagsAdd puts tags on a file, creating the ones the user doesn't have yet
+func FileTagsAdd(c *gin.Context, d *internal.Deps) {
+	file, tags, ok := bindFileTags(c, d)
+	if !ok {
+		return
+	}
+
+	requestID := c.MustGet("requestID").(string)
+
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		rows, err := service.EnsureTags(tx, file.UserID, tags)
+		if err != nil {
+			return err
+		}
+
+		return service.AddFileTags(tx, file.ID, rows)
+	})
+	if err != nil {
+		if err == service.ErrTooManyTags {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to add file tags", zap.Error(err))
+		return
+	}
+
+	respondFileTags(c, d, &file)
+}
+
+// FileTagsRemove takes tags off a file. The tags themselves are kept
+func FileTagsRemove(c *gin.Context, d *internal.Deps) {
+	file, tags, ok := bindFileTags(c, d)
+	if !ok {
+		return
+	}
+
+	requestID := c.MustGet("requestID").(string)
+
+	if err := service.RemoveFileTags(d.DB, file.UserID, []uint{file.ID}, tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to remove file tags", zap.Error(err))
+		return
+	}
+
+	respondFileTags(c, d, &file)
+}
+
+func respondFileTags(c *gin.Context, d *internal.Deps, file *model.File) {
+	requestID := c.MustGet("requestID").(string)
+
+	if err := service.LoadFileTags(d.DB, file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": file.Tags})
+}
+
+// bindFileTags reads the tags from the body and fetches the file. The error
+// response is written if ok is false
+func bindFileTags(c *gin.Context, d *internal.Deps) (file model.File, tags []string, ok bool) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data fileTagsOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	tags, err := validators.TagsValidator(data.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		Select("id", "user_id").
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	return file, tags, true
+}
@@ -0,0 +1,191 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FileThumbnail replaces the thumbnail of a file with either the frame at
+// the provided timestamp or an uploaded image. The existing thumbnail object
+// is overwritten and the version is bumped so caches refresh
+func FileThumbnail(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	tsStr := c.PostForm("timestamp")
+	fh, _ := c.FormFile("image")
+
+	if tsStr == "" && fh == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Either a timestamp or an image has to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if tsStr != "" && fh != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Provide either a timestamp or an image, not both",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	var thumbPath string
+
+	if tsStr != "" {
+		ts, err := strconv.ParseFloat(tsStr, 64)
+		if err != nil || ts < 0 || ts > file.Duration {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Timestamp must be a number within the video duration",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		// FFmpeg seeks with range requests so the whole video isn't downloaded
+		thumbPath, err = service.MakeThumbnailAt(os.Getenv("CLOUDFRONT_URL")+"/"+file.FileKey, ts, d.JobQueue, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to create thumbnail from timestamp", zap.Error(err))
+			return
+		}
+	} else {
+		code, f, err := validators.ImageValidator(fh)
+		if err != nil {
+			if code == http.StatusInternalServerError {
+				zap.L().Error("Failed to validate image", zap.Error(err))
+				err = errors.New("Internal server error")
+			}
+
+			c.JSON(code, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+		defer f.Close()
+
+		temp, err := os.CreateTemp("", "thumb-upload-*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to create temporary file", zap.Error(err))
+			return
+		}
+		defer temp.Close()
+		defer os.Remove(temp.Name())
+
+		if _, err := io.Copy(temp, f); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to copy image to temporary file", zap.Error(err))
+			return
+		}
+
+		thumbPath, err = service.ConvertThumbnail(temp.Name(), d.JobQueue, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to convert uploaded thumbnail", zap.Error(err))
+			return
+		}
+	}
+	defer os.Remove(thumbPath)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+	defer cancel()
+
+	if err := d.Uploader.PutFile(ctx, thumbPath, file.ThumbKey, "image/webp"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to upload thumbnail to S3", zap.Error(err))
+		return
+	}
+
+	file.Version++
+
+	err = d.DB.
+		Model(&file).
+		Update("version", file.Version).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to bump file version", zap.Error(err))
+		return
+	}
+
+	if err := service.LoadFileTags(d.DB, &file); err != nil {
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+	}
+
+	file.VersionKeys()
+
+	c.JSON(http.StatusOK, file)
+}
@@ -7,6 +7,9 @@ import (
 	"bitwise74/video-api/pkg/util"
 	"bitwise74/video-api/pkg/validators"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
 	"os"
@@ -18,6 +21,14 @@ import (
 	"gorm.io/gorm"
 )
 
+type uploadResponse struct {
+	*model.File
+	Duplicates []uint `json:"duplicates,omitempty"` // Stored files with the same content
+}
+
+// FileUpload stores a new video. Uploads with the same content as a stored
+// file are refused or reported in the response depending on the user's
+// duplicate policy
 func FileUpload(c *gin.Context, d *internal.Deps) {
 	requestID := c.MustGet("requestID").(string)
 	userID := c.MustGet("userID").(string)
@@ -41,7 +52,27 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	code, f, err := validators.FileValidator(fh, d.DB, userID)
+	expiresAt, err := validators.FormExpiryValidator(c.PostForm("expiresIn"), c.PostForm("expiresAt"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	plan, err := service.UserPlan(d.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch user plan", zap.Error(err))
+		return
+	}
+
+	code, f, err := validators.FileValidator(fh, d.DB, userID, plan)
 	if err != nil {
 		c.JSON(code, gin.H{
 			"error":     err.Error(),
@@ -64,7 +95,11 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 	defer temp.Close()
 	defer os.Remove(temp.Name())
 
-	_, err = io.Copy(temp, f)
+	// The uploaded bytes are hashed while they're copied. Processing isn't
+	// deterministic so duplicates are found by what the user sent
+	h := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(temp, h), f)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":     "Internal server error",
@@ -75,6 +110,63 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	// Duplicates are refused before anything is processed or uploaded
+	duplicates, err := service.DuplicatesOf(d.DB, userID, sum)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check for duplicates", zap.Error(err))
+		return
+	}
+
+	if len(duplicates) > 0 {
+		policy, err := service.DuplicatePolicy(d.DB, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to fetch duplicate policy", zap.Error(err))
+			return
+		}
+
+		if policy == "refuse" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "This file was uploaded already",
+				"duplicates": duplicates,
+				"requestID":  requestID,
+			})
+			return
+		}
+	}
+
+	if plan.MaxDuration > 0 {
+		duration, err := service.GetDuration(temp.Name())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Failed to read the video duration",
+				"requestID": requestID,
+			})
+
+			zap.L().Warn("Failed to probe uploaded file", zap.Error(err))
+			return
+		}
+
+		if code, err := validators.DurationValidator(duration, plan); err != nil {
+			c.JSON(code, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+	}
+
 	tempProcessed, err := os.CreateTemp("", "processed-*.mp4")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -132,6 +224,14 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 		Done:     done,
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrTooManyJobs) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":     "Your plan doesn't allow more jobs at once. Wait for one to finish",
+				"requestID": requestID,
+			})
+			return
+		}
+
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"error":     "Job queue is full. Please wait a moment before trying again",
 			"requestID": requestID,
@@ -160,7 +260,7 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	fileEnt, err := d.Uploader.Do(tempProcessed.Name(), fh.Filename, userID)
+	fileEnt, err := d.Uploader.DoPrepared(tempProcessed.Name(), fh.Filename, userID, "video/mp4", &service.Prepared{SHA256: sum})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":     "Internal server error",
@@ -171,11 +271,21 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	fileEnt.ExpiresAt = expiresAt
+
 	err = d.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&fileEnt).Error; err != nil {
 			return err
 		}
 
+		if err := service.AcquireBlob(tx, fileEnt.FileKey, fileEnt.SHA256, fileEnt.Size); err != nil {
+			return err
+		}
+
+		if err := service.ReleaseHold(tx, fileEnt.FileKey); err != nil {
+			return err
+		}
+
 		if err := tx.
 			Model(model.Stats{}).
 			Where("user_id = ?", userID).
@@ -196,8 +306,17 @@ func FileUpload(c *gin.Context, d *internal.Deps) {
 		})
 
 		zap.L().Error("Database transaction failed", zap.String("requestID", requestID), zap.Error(err))
+
+		if err := d.Uploader.Abandon(fileEnt); err != nil {
+			zap.L().Error("Failed to clean up unsaved upload", zap.Error(err))
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, fileEnt)
+	service.PostUpload(d.DB, d.Uploader, *fileEnt)
+
+	c.JSON(http.StatusOK, uploadResponse{
+		File:       fileEnt,
+		Duplicates: duplicates,
+	})
 }
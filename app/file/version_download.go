@@ -0,0 +1,99 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FileVersionDownload streams a single version of a file as an attachment
+func FileVersionDownload(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	versionID := c.Param("versionID")
+	if fileID == "" || versionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file or version ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var v model.FileVersion
+	err := d.DB.
+		Where("user_id = ? AND file_id = ? AND id = ?", userID, fileID, versionID).
+		First(&v).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Version not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file version", zap.Error(err))
+		return
+	}
+
+	var file model.File
+	err = d.DB.
+		Where("id = ?", v.FileID).
+		Scopes(service.NotExpired).
+		Select("original_name", "format").
+		First(&file).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	resp, err := d.S3.C.GetObject(c.Request.Context(), &s3.GetObjectInput{
+		Bucket: d.S3.Bucket,
+		Key:    &v.FileKey,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch version from S3", zap.String("key", v.FileKey), zap.Error(err))
+		return
+	}
+	defer resp.Body.Close()
+
+	name := fmt.Sprintf("v%d-%s", v.Number, file.OriginalName)
+
+	c.Header("Content-Type", file.Format)
+	c.Header("Content-Length", strconv.FormatInt(v.Size, 10))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		zap.L().Warn("Failed to stream file version", zap.Error(err))
+	}
+}
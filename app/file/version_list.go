@@ -0,0 +1,101 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var versionSort = &service.Sort[model.FileVersion]{
+	Name:   "newest",
+	Column: "file_versions.number",
+	ID:     "file_versions.id",
+	Desc:   true,
+	Key:    func(v *model.FileVersion) (any, uint) { return v.Number, v.ID },
+}
+
+// FileVersions lists the retained versions of a file, newest first. Files
+// that were never edited don't have any
+func FileVersions(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), versionSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		Select("id", "file_key").
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	query := d.DB.
+		Model(model.FileVersion{}).
+		Where("file_id = ?", file.ID)
+
+	page, err := service.Paginate(query, versionSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file versions", zap.Error(err))
+		return
+	}
+
+	for i := range page.Items {
+		page.Items[i].Current = page.Items[i].FileKey == file.FileKey
+	}
+
+	c.JSON(http.StatusOK, page)
+}
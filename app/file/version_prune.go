@@ -0,0 +1,130 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FileVersionPrune deletes old versions of a file to free up storage. The
+// current version and the newest "keep" other versions are left alone
+func FileVersionPrune(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	keep, err := strconv.Atoi(c.DefaultQuery("keep", "0"))
+	if err != nil || keep < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Keep must be a positive number",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		Select("id", "file_key").
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	var versions []model.FileVersion
+	err = d.DB.
+		Where("file_id = ? AND file_key != ?", file.ID, file.FileKey).
+		Order("number desc").
+		Offset(keep).
+		Find(&versions).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file versions", zap.Error(err))
+		return
+	}
+
+	if len(versions) == 0 {
+		c.JSON(http.StatusOK, gin.H{"pruned": 0, "freed": 0})
+		return
+	}
+
+	ids := make([]uint, len(versions))
+	keys := []string{}
+	var freed int64
+
+	for i, v := range versions {
+		ids[i] = v.ID
+		keys = append(keys, v.ObjectKeys()...)
+		freed += v.Size
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id IN ?", ids).Delete(model.FileVersion{}).Error; err != nil {
+			return err
+		}
+
+		// Blobs other files or versions still use are kept
+		keys, err := service.ReleaseBlobs(tx, keys)
+		if err != nil {
+			return err
+		}
+
+		if err := service.EnqueueDeletes(tx, keys); err != nil {
+			return err
+		}
+
+		return tx.
+			Model(model.Stats{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]any{
+				"used_storage": gorm.Expr("used_storage - ?", freed),
+			}).
+			Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to prune file versions", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pruned": len(versions), "freed": freed})
+}
@@ -0,0 +1,115 @@
+package file
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FileVersionRevert makes a retained version the current one. Versions
+// aren't removed by reverting so it can be undone
+func FileVersionRevert(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	fileID := c.Param("id")
+	versionID := c.Param("versionID")
+	if fileID == "" || versionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file or version ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var file model.File
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, fileID).
+		Scopes(service.NotExpired).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file from db", zap.Error(err))
+		return
+	}
+
+	var v model.FileVersion
+	err = d.DB.
+		Where("file_id = ? AND id = ?", file.ID, versionID).
+		First(&v).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Version not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch file version", zap.Error(err))
+		return
+	}
+
+	if v.FileKey == file.FileKey {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Version is already the current one",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	// Every version is stored already so storage usage doesn't change
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		stale, err := service.SwitchVersion(tx, &file, &v)
+		if err != nil {
+			return err
+		}
+
+		if err := service.EnqueueDeletes(tx, stale); err != nil {
+			return err
+		}
+
+		return tx.Save(&file).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to revert file", zap.Error(err))
+		return
+	}
+
+	service.PostUpload(d.DB, d.Uploader, file)
+
+	if err := service.LoadFileTags(d.DB, &file); err != nil {
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, file)
+}
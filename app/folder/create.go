@@ -0,0 +1,112 @@
+package folder
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type folderOpts struct {
+	Name     *string `json:"name"`
+	ParentID *uint   `json:"parent_id"` // 0 moves a folder to the root
+}
+
+// FolderCreate creates a new folder, optionally inside another one
+func FolderCreate(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var data folderOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if data.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No name provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	name, err := validators.LibraryName(*data.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	folder := model.Folder{
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if data.ParentID != nil && *data.ParentID != 0 {
+		if !checkParent(c, d, 0, *data.ParentID) {
+			return
+		}
+
+		folder.ParentID = data.ParentID
+	}
+
+	if err := d.DB.Create(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to create folder", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
+
+// checkParent writes the error response and returns false if the folder
+// can't be placed inside parent
+func checkParent(c *gin.Context, d *internal.Deps, folder, parent uint) bool {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	err := service.CheckFolderParent(d.DB, userID, folder, parent)
+	if err == nil {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, service.ErrFolderNotOwned), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":     "Parent folder not found",
+			"requestID": requestID,
+		})
+	case errors.Is(err, service.ErrFolderCycle), errors.Is(err, service.ErrFolderTooDeep):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to check parent folder", zap.Error(err))
+	}
+
+	return false
+}
@@ -0,0 +1,85 @@
+package folder
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FolderDelete removes a folder. Files and folders inside of it are moved
+// to its parent so nothing is lost
+func FolderDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	folderID := c.Param("id")
+	if folderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No folder ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var folder model.Folder
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, folderID).
+		First(&folder).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Folder not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch folder", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		// Trashed files are moved too so they have a folder once restored
+		err := tx.
+			Unscoped().
+			Model(model.File{}).
+			Where("user_id = ? AND folder_id = ?", userID, folder.ID).
+			Update("folder_id", folder.ParentID).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.
+			Model(model.Folder{}).
+			Where("user_id = ? AND parent_id = ?", userID, folder.ID).
+			Update("parent_id", folder.ParentID).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&folder).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete folder", zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,104 @@
+package folder
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// FolderEdit renames a folder and/or moves it into another one
+func FolderEdit(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	folderID := c.Param("id")
+	if folderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No folder ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data folderOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if data.Name == nil && data.ParentID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No edit options provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var folder model.Folder
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, folderID).
+		First(&folder).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Folder not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch folder", zap.Error(err))
+		return
+	}
+
+	if data.Name != nil {
+		name, err := validators.LibraryName(*data.Name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		folder.Name = name
+	}
+
+	if data.ParentID != nil {
+		if *data.ParentID == 0 {
+			folder.ParentID = nil
+		} else {
+			if !checkParent(c, d, folder.ID, *data.ParentID) {
+				return
+			}
+
+			folder.ParentID = data.ParentID
+		}
+	}
+
+	if err := d.DB.Save(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update folder", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, folder)
+}
@@ -0,0 +1,61 @@
+package folder
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var folderSort = &service.Sort[model.Folder]{
+	Name:   "name",
+	Column: "folders.name",
+	ID:     "folders.id",
+	Key:    func(f *model.Folder) (any, uint) { return f.Name, f.ID },
+}
+
+// FolderList returns a page of a user's folders. The tree is built by the client
+// from the parent IDs once every page is fetched
+func FolderList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), folderSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Model(model.Folder{}).
+		Where("user_id = ?", userID)
+
+	page, err := service.Paginate(query, folderSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch folders", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,79 @@
+package preset
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type presetOpts struct {
+	Name    *string                       `json:"name"`
+	Options *validators.ProcessingOptions `json:"options"`
+}
+
+// PresetCreate saves a named set of processing options
+func PresetCreate(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var data presetOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if data.Name == nil || data.Options == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "A name and options have to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if code, err := validators.PresetValidator(data.Name, data.Options); err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	options, err := json.Marshal(data.Options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to encode preset options", zap.Error(err))
+		return
+	}
+
+	preset := model.Preset{
+		UserID:    userID,
+		Name:      *data.Name,
+		Options:   options,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if err := d.DB.Create(&preset).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to save preset", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
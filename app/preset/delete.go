@@ -0,0 +1,48 @@
+package preset
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// PresetDelete removes a processing preset
+func PresetDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	presetID := c.Param("id")
+	if presetID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No preset ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	res := d.DB.
+		Where("user_id = ? AND id = ?", userID, presetID).
+		Delete(&model.Preset{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete preset", zap.Error(res.Error))
+		return
+	}
+
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":     "Preset not found",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package preset
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PresetEdit renames a preset and/or replaces its options
+func PresetEdit(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	presetID := c.Param("id")
+	if presetID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No preset ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data presetOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if data.Name == nil && data.Options == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No edit options provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if code, err := validators.PresetValidator(data.Name, data.Options); err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var preset model.Preset
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, presetID).
+		First(&preset).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Preset not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch preset", zap.Error(err))
+		return
+	}
+
+	if data.Name != nil {
+		preset.Name = *data.Name
+	}
+
+	if data.Options != nil {
+		preset.Options, err = json.Marshal(data.Options)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to encode preset options", zap.Error(err))
+			return
+		}
+	}
+
+	if err := d.DB.Save(&preset).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update preset", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
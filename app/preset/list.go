@@ -0,0 +1,60 @@
+package preset
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var presetSort = &service.Sort[model.Preset]{
+	Name:   "name",
+	Column: "presets.name",
+	ID:     "presets.id",
+	Key:    func(p *model.Preset) (any, uint) { return p.Name, p.ID },
+}
+
+// PresetList lists the processing presets of a user
+func PresetList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), presetSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Model(model.Preset{}).
+		Where("user_id = ?", userID)
+
+	page, err := service.Paginate(query, presetSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch presets", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -1,10 +1,17 @@
 package app
 
 import (
+	"bitwise74/video-api/app/admin"
+	"bitwise74/video-api/app/collection"
 	"bitwise74/video-api/app/ffmpeg"
 	"bitwise74/video-api/app/file"
+	"bitwise74/video-api/app/folder"
+	"bitwise74/video-api/app/preset"
 	"bitwise74/video-api/app/root"
+	"bitwise74/video-api/app/tag"
+	"bitwise74/video-api/app/trash"
 	"bitwise74/video-api/app/user"
+	"bitwise74/video-api/app/watermark"
 	"bitwise74/video-api/aws"
 	"bitwise74/video-api/db"
 	"bitwise74/video-api/internal"
@@ -27,17 +34,17 @@ import (
 var store = persist.NewMemoryStore(time.Minute)
 
 func NewRouter() (*gin.Engine, error) {
-	d := &internal.Deps{
-		JobQueue: service.NewJobQueue(),
-	}
+	d := &internal.Deps{}
 
 	router := gin.New()
 
 	db, err := db.New()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize SQLite database, %w", err)
+		return nil, fmt.Errorf("failed to initialize database, %w", err)
 	}
 	d.DB = db
+	d.JobQueue = service.NewJobQueue(db)
+	d.FullTextSearch = service.SetupSearch(db)
 
 	origins := strings.Split(os.Getenv("HOST_CORS"), ",")
 
@@ -62,6 +69,7 @@ func NewRouter() (*gin.Engine, error) {
 	rateLimit, _ := strconv.Atoi(os.Getenv("SECURITY_RATE_LIMIT"))
 
 	jwt := middleware.NewJWTMiddleware(db)
+	adminOnly := middleware.NewAdminMiddleware(db)
 	turnstile := middleware.NewTurnstileMiddleware()
 	rateLimiter := middleware.RateLimiterMiddleware(middleware.RateLimiterConfig{
 		RequestsPerSecond: rateLimit,
@@ -83,6 +91,9 @@ func NewRouter() (*gin.Engine, error) {
 		// GET /api/users		-> Returns the basic info of a user
 		u.GET("", jwt, func(c *gin.Context) { user.UserFetch(c, d) })
 
+		// PATCH /api/users/settings	-> Updates the settings of a user
+		u.PATCH("/settings", jwt, func(c *gin.Context) { user.UserSettings(c, d) })
+
 		// POST /api/users 		-> Registers a new user
 		u.POST("", func(c *gin.Context) { user.UserRegister(c, d) })
 
@@ -110,14 +121,146 @@ func NewRouter() (*gin.Engine, error) {
 		// POST /api/files         	-> Uploads a new file and stores it in the database
 		ff.POST("", func(c *gin.Context) { file.FileUpload(c, d) })
 
+		// POST /api/files/batch	-> Applies one operation to many files at once
+		ff.POST("/batch", func(c *gin.Context) { file.FileBatch(c, d) })
+
 		// PATCH /api/files/:id		-> Updates a file
 		ff.PATCH("/:id", func(c *gin.Context) { file.FileEdit(c, d) })
 
-		// DELETE /api/files/:id	-> Deletes a file owned by a user
+		// POST /api/files/:id/thumbnail	-> Sets a file's thumbnail from a timestamp or an uploaded image
+		ff.POST("/:id/thumbnail", func(c *gin.Context) { file.FileThumbnail(c, d) })
+
+		// POST /api/files/:id/export/:format	-> Exports part of a video as a gif or an animated webp
+		ff.POST("/:id/export/:format", func(c *gin.Context) { file.FileExport(c, d) })
+
+		// GET /api/files/:id/subtitles	-> Lists the subtitle tracks of a file
+		ff.GET("/:id/subtitles", func(c *gin.Context) { file.FileSubtitles(c, d) })
+
+		// POST /api/files/:id/subtitles	-> Attaches an SRT or VTT subtitle track to a file
+		ff.POST("/:id/subtitles", func(c *gin.Context) { file.FileSubtitleAdd(c, d) })
+
+		// DELETE /api/files/:id/subtitles/:subID	-> Removes a subtitle track from a file
+		ff.DELETE("/:id/subtitles/:subID", func(c *gin.Context) { file.FileSubtitleDelete(c, d) })
+
+		// POST /api/files/:id/tags	-> Adds tags to a file
+		ff.POST("/:id/tags", func(c *gin.Context) { file.FileTagsAdd(c, d) })
+
+		// DELETE /api/files/:id/tags	-> Removes tags from a file
+		ff.DELETE("/:id/tags", func(c *gin.Context) { file.FileTagsRemove(c, d) })
+
+		// GET /api/files/:id/versions	-> Lists the retained versions of a file
+		ff.GET("/:id/versions", func(c *gin.Context) { file.FileVersions(c, d) })
+
+		// GET /api/files/:id/versions/:versionID	-> Downloads a single version of a file
+		ff.GET("/:id/versions/:versionID", func(c *gin.Context) { file.FileVersionDownload(c, d) })
+
+		// POST /api/files/:id/versions/:versionID/revert	-> Makes a version the current one
+		ff.POST("/:id/versions/:versionID/revert", func(c *gin.Context) { file.FileVersionRevert(c, d) })
+
+		// DELETE /api/files/:id/versions	-> Prunes old versions of a file, keeping the newest ?keep=N
+		ff.DELETE("/:id/versions", func(c *gin.Context) { file.FileVersionPrune(c, d) })
+
+		// DELETE /api/files/:id	-> Moves a file owned by a user to the trash
 		ff.DELETE("/:id", func(c *gin.Context) { file.FileDelete(c, d) })
 
-		// GET /api/files/search	-> Searches for files saved in the database
-		ff.GET("/search", cacheFor(15), func(c *gin.Context) { file.FileSearch(c, d) })
+		// GET /api/files/duplicates	-> Groups a user's files with the same or similar content
+		ff.GET("/duplicates", func(c *gin.Context) { file.FileDuplicates(c, d) })
+
+		// GET /api/files/search	-> Searches names, tags, descriptions and subtitles of a user's files
+		ff.GET("/search", func(c *gin.Context) { file.FileSearch(c, d) })
+	}
+
+	tr := m.Group("/trash", jwt)
+	{
+		// GET /api/trash		-> Lists a user's trashed files
+		tr.GET("", func(c *gin.Context) { trash.TrashList(c, d) })
+
+		// POST /api/trash/:id/restore	-> Takes a file out of the trash
+		tr.POST("/:id/restore", func(c *gin.Context) { trash.TrashRestore(c, d) })
+
+		// DELETE /api/trash/:id	-> Permanently deletes a trashed file
+		tr.DELETE("/:id", func(c *gin.Context) { trash.TrashPurge(c, d) })
+
+		// DELETE /api/trash		-> Permanently deletes every trashed file
+		tr.DELETE("", func(c *gin.Context) { trash.TrashEmpty(c, d) })
+	}
+
+	w := m.Group("/watermarks", jwt)
+	{
+		// GET /api/watermarks		-> Lists a user's watermark presets
+		w.GET("", func(c *gin.Context) { watermark.WatermarkList(c, d) })
+
+		// POST /api/watermarks		-> Creates an image or text watermark preset
+		w.POST("", func(c *gin.Context) { watermark.WatermarkCreate(c, d) })
+
+		// PATCH /api/watermarks/:id	-> Updates the settings of a watermark preset
+		w.PATCH("/:id", func(c *gin.Context) { watermark.WatermarkEdit(c, d) })
+
+		// DELETE /api/watermarks/:id	-> Deletes a watermark preset
+		w.DELETE("/:id", func(c *gin.Context) { watermark.WatermarkDelete(c, d) })
+	}
+
+	t := m.Group("/tags", jwt)
+	{
+		// GET /api/tags		-> Lists a user's tags with how many files use them
+		t.GET("", func(c *gin.Context) { tag.TagList(c, d) })
+
+		// PATCH /api/tags/:id		-> Renames a tag, merging it if the name is taken
+		t.PATCH("/:id", func(c *gin.Context) { tag.TagEdit(c, d) })
+
+		// DELETE /api/tags/:id		-> Removes a tag from every file and deletes it
+		t.DELETE("/:id", func(c *gin.Context) { tag.TagDelete(c, d) })
+	}
+
+	fo := m.Group("/folders", jwt)
+	{
+		// GET /api/folders		-> Lists every folder of a user
+		fo.GET("", func(c *gin.Context) { folder.FolderList(c, d) })
+
+		// POST /api/folders		-> Creates a folder, optionally inside another one
+		fo.POST("", func(c *gin.Context) { folder.FolderCreate(c, d) })
+
+		// PATCH /api/folders/:id	-> Renames or moves a folder
+		fo.PATCH("/:id", func(c *gin.Context) { folder.FolderEdit(c, d) })
+
+		// DELETE /api/folders/:id	-> Deletes a folder, its contents move to the parent
+		fo.DELETE("/:id", func(c *gin.Context) { folder.FolderDelete(c, d) })
+	}
+
+	co := m.Group("/collections", jwt)
+	{
+		// GET /api/collections		-> Lists a user's collections
+		co.GET("", func(c *gin.Context) { collection.CollectionList(c, d) })
+
+		// POST /api/collections	-> Creates a collection
+		co.POST("", func(c *gin.Context) { collection.CollectionCreate(c, d) })
+
+		// PATCH /api/collections/:id	-> Renames a collection
+		co.PATCH("/:id", func(c *gin.Context) { collection.CollectionEdit(c, d) })
+
+		// DELETE /api/collections/:id	-> Deletes a collection, its files are kept
+		co.DELETE("/:id", func(c *gin.Context) { collection.CollectionDelete(c, d) })
+
+		// POST /api/collections/:id/files	-> Adds files to a collection
+		co.POST("/:id/files", func(c *gin.Context) { collection.CollectionAddFiles(c, d) })
+
+		// DELETE /api/collections/:id/files	-> Removes files from a collection
+		co.DELETE("/:id/files", func(c *gin.Context) { collection.CollectionRemoveFiles(c, d) })
+	}
+
+	p := m.Group("/presets", jwt)
+	{
+		// GET /api/presets		-> Lists a user's processing presets
+		p.GET("", func(c *gin.Context) { preset.PresetList(c, d) })
+
+		// POST /api/presets		-> Saves a named set of processing options
+		p.POST("", func(c *gin.Context) { preset.PresetCreate(c, d) })
+
+		// PATCH /api/presets/:id	-> Renames a preset or replaces its options
+		p.PATCH("/:id", func(c *gin.Context) { preset.PresetEdit(c, d) })
+
+		// DELETE /api/presets/:id	-> Deletes a processing preset
+		p.DELETE("/:id", func(c *gin.Context) { preset.PresetDelete(c, d) })
 	}
 
 	f := m.Group("/ffmpeg", jwt)
@@ -132,6 +275,30 @@ func NewRouter() (*gin.Engine, error) {
 		f.POST("/process", turnstile, ffmpeg.FFMpegStart)
 	}
 
+	ad := m.Group("/admin", jwt, adminOnly)
+	{
+		// GET /api/admin/plans		-> Lists every plan
+		ad.GET("/plans", func(c *gin.Context) { admin.PlanList(c, d) })
+
+		// POST /api/admin/plans	-> Creates a plan
+		ad.POST("/plans", func(c *gin.Context) { admin.PlanCreate(c, d) })
+
+		// PATCH /api/admin/plans/:id	-> Changes the limits of a plan
+		ad.PATCH("/plans/:id", func(c *gin.Context) { admin.PlanEdit(c, d) })
+
+		// DELETE /api/admin/plans/:id	-> Deletes a plan nobody is assigned to
+		ad.DELETE("/plans/:id", func(c *gin.Context) { admin.PlanDelete(c, d) })
+
+		// PUT /api/admin/users/:id/plan	-> Moves a user to another plan
+		ad.PUT("/users/:id/plan", func(c *gin.Context) { admin.UserPlanSet(c, d) })
+
+		// POST /api/admin/stats/reconcile	-> Recomputes every user's stats, ?verify=true checks S3 object sizes too
+		ad.POST("/stats/reconcile", func(c *gin.Context) { admin.StatsReconcile(c, d) })
+
+		// POST /api/admin/gc		-> Deletes orphaned objects from the bucket, ?dry_run=true only reports them
+		ad.POST("/gc", func(c *gin.Context) { admin.GarbageCollect(c, d) })
+	}
+
 	d.Argon = security.New()
 	s3, err := aws.NewS3()
 	if err != nil {
@@ -139,7 +306,7 @@ func NewRouter() (*gin.Engine, error) {
 	}
 
 	d.S3 = s3
-	d.Uploader = service.NewUploader(d.JobQueue, s3)
+	d.Uploader = service.NewUploader(d.JobQueue, s3, db)
 
 	// Start FFmpeg job queue
 	d.JobQueue.StartWorkerPool()
@@ -147,8 +314,25 @@ func NewRouter() (*gin.Engine, error) {
 	// Check for useless tokens every day because they expire rarely
 	go service.TokenCleanup(time.Hour*24, db)
 
+	// Deletions are recorded with the rows they belong to and done here
+	go service.OutboxWorker(time.Second*5, db, d.Uploader)
+
+	// Expired files should disappear soon after their expiry
+	go service.FileReaper(time.Minute, db)
+
+	// Trashed files are kept for days so checking hourly is plenty
+	go service.TrashPurge(time.Hour, db)
+
+	// Stats only drift through bugs or failed requests so once a day is enough
+	go service.StatsReconciler(time.Hour*24, db, d.Uploader)
+
+	// Orphans come from failed requests so collecting them daily is plenty
+	if gc, _ := strconv.ParseBool(os.Getenv("GC_ENABLE")); gc {
+		go service.ObjectGC(time.Hour*24, db, d.Uploader)
+	}
+
 	// Check for expired accounts rarely because they have a week to verify
-	go service.AccountCleanup(time.Hour*24*7, db, s3.C)
+	go service.AccountCleanup(time.Hour*24*7, db)
 
 	return router, nil
 }
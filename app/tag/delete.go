@@ -0,0 +1,68 @@
+package tag
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TagDelete removes a tag from every file and deletes it
+func TagDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	tagID := c.Param("id")
+	if tagID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No tag ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var tag model.Tag
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, tagID).
+		First(&tag).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Tag not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch tag", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(model.FileTag{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete tag", zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
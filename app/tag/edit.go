@@ -0,0 +1,120 @@
+package tag
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type tagOpts struct {
+	Name string `json:"name"`
+}
+
+// TagEdit renames a tag. Renaming to the name of another tag merges both
+// of them into the existing one
+func TagEdit(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	tagID := c.Param("id")
+	if tagID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No tag ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var data tagOpts
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	name, err := validators.NormalizeTag(data.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var tag model.Tag
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, tagID).
+		First(&tag).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Tag not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch tag", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		var target model.Tag
+
+		err := tx.
+			Where("user_id = ? AND name = ? AND id != ?", userID, name, tag.ID).
+			First(&target).
+			Error
+		if err == gorm.ErrRecordNotFound {
+			tag.Name = name
+			return tx.Save(&tag).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// Merge into the existing tag, files that have both keep one
+		err = tx.Exec(
+			"INSERT INTO file_tags (file_id, tag_id) SELECT file_id, ? FROM file_tags WHERE tag_id = ? ON CONFLICT DO NOTHING",
+			target.ID, tag.ID,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(model.FileTag{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&tag).Error; err != nil {
+			return err
+		}
+
+		tag = target
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to rename tag", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
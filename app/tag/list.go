@@ -0,0 +1,61 @@
+package tag
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var tagSort = &service.Sort[model.Tag]{
+	Name:   "name",
+	Column: "tags.name",
+	ID:     "tags.id",
+	Key:    func(t *model.Tag) (any, uint) { return t.Name, t.ID },
+}
+
+// TagList returns the tags of a user along with how many files use them
+func TagList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), tagSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Model(model.Tag{}).
+		Where("user_id = ?", userID).
+		Select("tags.*, (SELECT COUNT(*) FROM file_tags JOIN files ON files.id = file_tags.file_id WHERE file_tags.tag_id = tags.id AND files.deleted_at IS NULL) AS file_count")
+
+	page, err := service.Paginate(query, tagSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch tags", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,77 @@
+package trash
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var trashSort = &service.Sort[model.File]{
+	Name:   "newest",
+	Column: "files.deleted_at",
+	ID:     "files.id",
+	Desc:   true,
+	Key:    func(f *model.File) (any, uint) { return f.DeletedAt.Int64, f.ID },
+}
+
+// TrashList returns a page of a user's trashed files, the most recently
+// deleted first
+func TrashList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), trashSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Unscoped().
+		Model(model.File{}).
+		Where("files.user_id = ? AND files.deleted_at IS NOT NULL", userID)
+
+	page, err := service.Paginate(query, trashSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch trashed files", zap.Error(err))
+		return
+	}
+
+	if err := service.LoadTags(d.DB, page.Items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+		return
+	}
+
+	for i := range page.Items {
+		page.Items[i].VersionKeys()
+	}
+
+	c.JSON(http.StatusOK, page)
+}
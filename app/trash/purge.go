@@ -0,0 +1,74 @@
+package trash
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TrashPurge permanently deletes a single trashed file
+func TrashPurge(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	file, ok := trashedFile(c, d, requestID, userID)
+	if !ok {
+		return
+	}
+
+	if _, err := service.PurgeFiles(d.DB, "id = ? AND deleted_at IS NOT NULL", file.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to purge file", zap.Error(err))
+		return
+	}
+
+	respondStats(c, d, requestID, userID)
+}
+
+// TrashEmpty permanently deletes every trashed file of a user
+func TrashEmpty(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	_, err := service.PurgeFiles(d.DB, "user_id = ? AND deleted_at IS NOT NULL", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to empty trash", zap.Error(err))
+		return
+	}
+
+	respondStats(c, d, requestID, userID)
+}
+
+// respondStats responds with the storage stats of the user after a purge
+func respondStats(c *gin.Context, d *internal.Deps, requestID, userID string) {
+	var stats model.Stats
+
+	err := d.DB.
+		Where("user_id = ?", userID).
+		First(&stats).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch user stats", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,88 @@
+package trash
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// TrashRestore takes a file out of the trash
+func TrashRestore(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	file, ok := trashedFile(c, d, requestID, userID)
+	if !ok {
+		return
+	}
+
+	if _, err := service.RestoreFiles(d.DB, userID, []uint{file.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to restore file", zap.Error(err))
+		return
+	}
+
+	file.DeletedAt = model.DeletedAt{}
+
+	if err := service.LoadFileTags(d.DB, file); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+		return
+	}
+
+	file.VersionKeys()
+
+	c.JSON(http.StatusOK, file)
+}
+
+// trashedFile fetches a trashed file of the user from the id parameter. It
+// responds on its own and returns false if the file can't be used
+func trashedFile(c *gin.Context, d *internal.Deps, requestID, userID string) (*model.File, bool) {
+	fileID := c.Param("id")
+	if fileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No file ID provided",
+			"requestID": requestID,
+		})
+		return nil, false
+	}
+
+	var file model.File
+	err := d.DB.
+		Unscoped().
+		Where("user_id = ? AND id = ? AND deleted_at IS NOT NULL", userID, fileID).
+		First(&file).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "File not found in trash",
+				"requestID": requestID,
+			})
+			return nil, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch trashed file", zap.Error(err))
+		return nil, false
+	}
+
+	return &file, true
+}
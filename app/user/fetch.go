@@ -3,8 +3,8 @@ package user
 import (
 	"bitwise74/video-api/internal"
 	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -18,6 +18,7 @@ func UserFetch(c *gin.Context, d *internal.Deps) {
 
 	err := d.DB.
 		Where("user_id = ?", userID).
+		Scopes(service.NotExpired).
 		Order("created_at desc").
 		Limit(10).
 		Find(&videos).
@@ -32,10 +33,18 @@ func UserFetch(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	for i, file := range videos {
-		version := strconv.Itoa(file.Version)
-		videos[i].FileKey = file.FileKey + "?v=" + version
-		videos[i].ThumbKey = file.ThumbKey + "?v=" + version
+	if err := service.LoadTags(d.DB, videos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to load file tags", zap.Error(err))
+		return
+	}
+
+	for i := range videos {
+		videos[i].VersionKeys()
 	}
 
 	var stats model.Stats
@@ -53,8 +62,34 @@ func UserFetch(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
+	policy, err := service.DuplicatePolicy(d.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch initial user data", zap.Error(err))
+		return
+	}
+
+	plan, err := service.UserPlan(d.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch initial user data", zap.Error(err))
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"videos": videos,
 		"stats":  stats,
+		"plan":   plan,
+		"settings": gin.H{
+			"duplicate_policy": policy,
+		},
 	})
 }
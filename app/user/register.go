@@ -7,7 +7,6 @@ import (
 	"bitwise74/video-api/pkg/security"
 	"bitwise74/video-api/pkg/validators"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
@@ -63,7 +62,7 @@ func UserRegister(c *gin.Context, d *internal.Deps) {
 	r := d.DB.Model(model.User{}).
 		Select("count(*) > 0").
 		Where("email = ?", data.Email).
-		First(&found)
+		Find(&found)
 	if r.Error != nil && r.Error != gorm.ErrRecordNotFound {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":     "Internal server error",
@@ -135,7 +134,17 @@ func UserRegister(c *gin.Context, d *internal.Deps) {
 		return
 	}
 
-	maxStorage, _ := strconv.ParseInt(os.Getenv("STORAGE_MAX_USAGE"), 10, 64)
+	plan, err := service.DefaultPlan(d.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch default plan", zap.Error(err), zap.String("requestID", requestID))
+		return
+	}
+
 	expiry := time.Now().Add(time.Hour * 24 * 7)
 
 	if err := d.DB.Create(&model.User{
@@ -143,9 +152,10 @@ func UserRegister(c *gin.Context, d *internal.Deps) {
 		Email:        data.Email,
 		ExpiresAt:    &expiry,
 		PasswordHash: hash,
+		PlanID:       &plan.ID,
 		Stats: model.Stats{
 			UserID:     userID,
-			MaxStorage: maxStorage,
+			MaxStorage: plan.MaxStorage,
 		},
 		VerificationTokens: []model.VerificationToken{
 			*verifToken,
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var validDuplicatePolicies = []string{"warn", "refuse"}
+
+type userSettings struct {
+	DuplicatePolicy *string `json:"duplicate_policy"`
+}
+
+// UserSettings updates the settings of a user
+func UserSettings(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var data userSettings
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Malformed or invalid JSON request body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if data.DuplicatePolicy == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No settings provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if !slices.Contains(validDuplicatePolicies, *data.DuplicatePolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Duplicate policy must be either warn or refuse",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	err := d.DB.
+		Model(model.User{}).
+		Where("id = ?", userID).
+		Update("duplicate_policy", *data.DuplicatePolicy).
+		Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update user settings", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
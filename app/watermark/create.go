@@ -0,0 +1,139 @@
+package watermark
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// WatermarkCreate creates a new watermark preset. Image presets need a PNG
+// in the "image" field while text presets need the "text" field
+func WatermarkCreate(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	var opts validators.WatermarkOptions
+	if err := c.ShouldBind(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid watermark options provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if opts.Name == nil || opts.Type == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "A name and a type have to be provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	validators.WatermarkDefaults(&opts)
+
+	code, err := validators.WatermarkValidator(&opts)
+	if err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	wm := model.Watermark{
+		UserID:    userID,
+		Name:      *opts.Name,
+		Type:      *opts.Type,
+		Position:  *opts.Position,
+		Margin:    *opts.Margin,
+		Opacity:   *opts.Opacity,
+		Scale:     *opts.Scale,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if wm.Type == "text" {
+		if opts.Text == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Text watermarks need a text",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		wm.Text = *opts.Text
+	} else {
+		fh, _ := c.FormFile("image")
+
+		code, f, err := validators.ImageValidator(fh)
+		if err != nil {
+			if code == http.StatusInternalServerError {
+				zap.L().Error("Failed to validate watermark image", zap.Error(err))
+				err = errors.New("Internal server error")
+			}
+
+			c.JSON(code, gin.H{
+				"error":     err.Error(),
+				"requestID": requestID,
+			})
+			return
+		}
+
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to read watermark image", zap.Error(err))
+			return
+		}
+
+		// Transparency is what makes a watermark usable so only PNGs are allowed
+		if http.DetectContentType(data) != "image/png" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "Watermark images have to be PNGs",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		wm.ImageKey = fmt.Sprintf("watermarks/%s/%s.png", userID, util.RandStr(10))
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		if err := d.Uploader.PutBytes(ctx, data, wm.ImageKey, "image/png"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to upload watermark to S3", zap.Error(err))
+			return
+		}
+	}
+
+	if err := d.DB.Create(&wm).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to save watermark", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, wm)
+}
@@ -0,0 +1,73 @@
+package watermark
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// WatermarkDelete removes a watermark preset along with its image
+func WatermarkDelete(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	wmID := c.Param("id")
+	if wmID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No watermark ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var wm model.Watermark
+	err := d.DB.
+		Where("user_id = ? AND id = ?", userID, wmID).
+		First(&wm).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Watermark not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch watermark", zap.Error(err))
+		return
+	}
+
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&wm).Error; err != nil {
+			return err
+		}
+
+		if wm.ImageKey == "" {
+			return nil
+		}
+
+		return service.EnqueueDeletes(tx, []string{wm.ImageKey})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to delete watermark", zap.Error(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package watermark
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// WatermarkEdit updates the settings of a watermark preset. The type and
+// the image can't be changed, a new preset has to be created instead
+func WatermarkEdit(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	wmID := c.Param("id")
+	if wmID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "No watermark ID provided",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var opts validators.WatermarkOptions
+	if err := c.ShouldBindJSON(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid JSON body",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	code, err := validators.WatermarkValidator(&opts)
+	if err != nil {
+		c.JSON(code, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	var wm model.Watermark
+	err = d.DB.
+		Where("user_id = ? AND id = ?", userID, wmID).
+		First(&wm).
+		Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":     "Watermark not found",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch watermark", zap.Error(err))
+		return
+	}
+
+	if opts.Text != nil && wm.Type != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Only text watermarks have a text",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	if opts.Name != nil {
+		wm.Name = *opts.Name
+	}
+	if opts.Text != nil {
+		wm.Text = *opts.Text
+	}
+	if opts.Position != nil {
+		wm.Position = *opts.Position
+	}
+	if opts.Margin != nil {
+		wm.Margin = *opts.Margin
+	}
+	if opts.Opacity != nil {
+		wm.Opacity = *opts.Opacity
+	}
+	if opts.Scale != nil {
+		wm.Scale = *opts.Scale
+	}
+
+	if err := d.DB.Save(&wm).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to update watermark", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, wm)
+}
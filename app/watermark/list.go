@@ -0,0 +1,61 @@
+package watermark
+
+import (
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var watermarkSort = &service.Sort[model.Watermark]{
+	Name:   "newest",
+	Column: "watermarks.created_at",
+	ID:     "watermarks.id",
+	Desc:   true,
+	Key:    func(wm *model.Watermark) (any, uint) { return wm.CreatedAt, wm.ID },
+}
+
+// WatermarkList lists the watermark presets of a user
+func WatermarkList(c *gin.Context, d *internal.Deps) {
+	requestID := c.MustGet("requestID").(string)
+	userID := c.MustGet("userID").(string)
+
+	limit, err := validators.LimitValidator(c.Query("limit"), validators.DefaultPageLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     err.Error(),
+			"requestID": requestID,
+		})
+		return
+	}
+
+	cursor, err := service.DecodeCursor(c.Query("cursor"), watermarkSort.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Invalid cursor",
+			"requestID": requestID,
+		})
+		return
+	}
+
+	query := d.DB.
+		Model(model.Watermark{}).
+		Where("user_id = ?", userID)
+
+	page, err := service.Paginate(query, watermarkSort, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":     "Internal server error",
+			"requestID": requestID,
+		})
+
+		zap.L().Error("Failed to fetch watermarks", zap.Error(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -8,10 +8,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -21,6 +23,8 @@ import (
 
 var validLogLevels = []string{"debug", "info", "warn", "error"}
 
+var validDatabaseSchemes = []string{"postgres", "postgresql", "sqlite", "file"}
+
 const (
 	gray  = "\x1b[90m"
 	reset = "\x1b[0m"
@@ -107,6 +111,28 @@ func Setup() error {
 		return errors.New("no cors origins provided")
 	}
 
+	// Anything without a scheme is the path of a SQLite file
+	if scheme, _, ok := strings.Cut(os.Getenv("DATABASE_URL"), "://"); ok && !slices.Contains(validDatabaseSchemes, scheme) {
+		return errors.New("DATABASE_URL must be a postgres://, postgresql://, sqlite:// or file:// URL")
+	}
+
+	// SQLite reads the authority of file URIs as a host, only an empty one
+	// or localhost is accepted
+	if strings.HasPrefix(os.Getenv("DATABASE_URL"), "file://") {
+		u, err := url.Parse(os.Getenv("DATABASE_URL"))
+		if err != nil || (u.Host != "" && u.Host != "localhost") {
+			return errors.New("DATABASE_URL file:// URLs must have an empty authority, e.g. file:///data/database.db")
+		}
+	}
+
+	for _, key := range []string{"DATABASE_MAX_OPEN_CONNS", "DATABASE_MAX_IDLE_CONNS", "DATABASE_CONN_MAX_LIFETIME"} {
+		if v := os.Getenv(key); v != "" {
+			if val, err := strconv.Atoi(v); err != nil || val < 0 {
+				return fmt.Errorf("%s must be zero or a positive integer", key)
+			}
+		}
+	}
+
 	if os.Getenv("HOST_SSL_ENABLED") == "true" {
 		if os.Getenv("HOST_SSL_CERTIFICATE_PATH") == "" {
 			return errors.New("no SSL certificate provided")
@@ -131,34 +157,29 @@ func Setup() error {
 		}
 	}
 
+	// Only the vendor is detected here. The job queue probes which encoders
+	// actually work for it and falls back to software encoding otherwise
 	if os.Getenv("FFMPEG_USE_GPU") == "true" {
 		gpu, err := util.DetectGPU()
 		if err != nil {
 			zap.L().Warn("Failed to detect GPU, ffmpeg won't use it to encode/decode", zap.Error(err))
-			os.Setenv("FFMPEG_USE_GPU", "false")
 		}
 
-		if gpu == "" {
+		switch gpu {
+		case "nvidia", "amd", "intel":
+			os.Setenv("FFMPEG_GPU_VENDOR", gpu)
+			zap.L().Debug("Detected GPU", zap.String("vendor", gpu))
+		case "":
 			os.Setenv("FFMPEG_USE_GPU", "false")
 			zap.L().Warn("No GPU detected. If it exists ffmpeg won't be able to use it to encode/decode")
-		}
-
-		switch gpu {
-		case "nvidia":
-			os.Setenv("FFMPEG_HWACCEL", "cuda")
-			os.Setenv("FFMPEG_ENCODER", "h264_nvenc")
-		case "amd":
-			os.Setenv("FFMPEG_HWACCEL", "qsv")
-			os.Setenv("FFMPEG_ENCODER", "h264_qsv")
-		case "intel":
-			os.Setenv("FFMPEG_HWACCEL", "vaapi")
-			os.Setenv("FFMPEG_ENCODER", "h264_vaapi")
 		default:
 			zap.L().Warn("Unknown GPU detected, ffmpeg won't use it to encode/decode", zap.String("gpu", gpu))
 			os.Setenv("FFMPEG_USE_GPU", "false")
 		}
 
-		zap.L().Debug("Detected GPU", zap.String("vendor", gpu))
+		if os.Getenv("FFMPEG_VAAPI_DEVICE") == "" {
+			os.Setenv("FFMPEG_VAAPI_DEVICE", "/dev/dri/renderD128")
+		}
 	}
 
 	if val, err := strconv.Atoi(os.Getenv("FFMPEG_MAX_JOBS")); err != nil {
@@ -173,6 +194,58 @@ func Setup() error {
 		return errors.New("FFMPEG_WORKERS must be set least 1")
 	}
 
+	if os.Getenv("SPRITES_ENABLE") == "true" {
+		if os.Getenv("SPRITES_INTERVAL") == "" {
+			os.Setenv("SPRITES_INTERVAL", "5")
+		}
+
+		if os.Getenv("SPRITES_TILE_WIDTH") == "" {
+			os.Setenv("SPRITES_TILE_WIDTH", "160")
+		}
+
+		if os.Getenv("SPRITES_COLUMNS") == "" {
+			os.Setenv("SPRITES_COLUMNS", "10")
+		}
+
+		if val, err := strconv.ParseFloat(os.Getenv("SPRITES_INTERVAL"), 64); err != nil || val <= 0 {
+			return errors.New("SPRITES_INTERVAL must be a positive number")
+		}
+
+		if val, err := strconv.Atoi(os.Getenv("SPRITES_TILE_WIDTH")); err != nil || val < 16 || val > 640 {
+			return errors.New("SPRITES_TILE_WIDTH must be between 16 and 640")
+		}
+
+		if val, err := strconv.Atoi(os.Getenv("SPRITES_COLUMNS")); err != nil || val < 1 || val > 20 {
+			return errors.New("SPRITES_COLUMNS must be between 1 and 20")
+		}
+	}
+
+	if os.Getenv("PREVIEWS_ENABLE") == "true" {
+		if os.Getenv("PREVIEWS_SEGMENTS") == "" {
+			os.Setenv("PREVIEWS_SEGMENTS", "5")
+		}
+
+		if os.Getenv("PREVIEWS_SEGMENT_LENGTH") == "" {
+			os.Setenv("PREVIEWS_SEGMENT_LENGTH", "1")
+		}
+
+		if os.Getenv("PREVIEWS_WIDTH") == "" {
+			os.Setenv("PREVIEWS_WIDTH", "320")
+		}
+
+		if val, err := strconv.Atoi(os.Getenv("PREVIEWS_SEGMENTS")); err != nil || val < 1 || val > 20 {
+			return errors.New("PREVIEWS_SEGMENTS must be between 1 and 20")
+		}
+
+		if val, err := strconv.ParseFloat(os.Getenv("PREVIEWS_SEGMENT_LENGTH"), 64); err != nil || val <= 0 || val > 10 {
+			return errors.New("PREVIEWS_SEGMENT_LENGTH must be a number between 0 and 10")
+		}
+
+		if val, err := strconv.Atoi(os.Getenv("PREVIEWS_WIDTH")); err != nil || val < 32 || val > 1280 || val%2 != 0 {
+			return errors.New("PREVIEWS_WIDTH must be an even number between 32 and 1280")
+		}
+	}
+
 	if os.Getenv("SECURITY_JWT_SECRET") == "" {
 		zap.L().Warn("You haven't set a JWT secret, so it has been generated for you. Please set it as an environment variable or in the config.toml file.", zap.String("secret", genSecret()))
 		os.Exit(0)
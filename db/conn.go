@@ -1,36 +1,102 @@
-// Package db contains things related to SQlite
+// Package db contains things related to the database. SQLite and PostgreSQL
+// are supported, DATABASE_URL picks which one is used
 package db
 
 import (
 	"bitwise74/video-api/internal/model"
 	"bitwise74/video-api/pkg/util"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func New() (*gorm.DB, error) {
+// Used when DATABASE_URL is empty
+const defaultSQLitePath = "database.db"
+
+// dialector picks the driver for a DATABASE_URL. postgres:// and
+// postgresql:// URLs use PostgreSQL, anything else is a SQLite file path
+// optionally prefixed with sqlite:// or a file: URI
+func dialector(url string) gorm.Dialector {
+	switch {
+	case url == "":
+		return sqlite.Open(defaultSQLitePath)
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return postgres.Open(url)
+	default:
+		return sqlite.Open(strings.TrimPrefix(url, "sqlite://"))
+	}
+}
+
+// configurePool applies the connection pool settings from the environment.
+// Unset values keep the defaults of database/sql
+func configurePool(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("DATABASE_MAX_OPEN_CONNS")); err == nil {
+		sqlDB.SetMaxOpenConns(n)
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("DATABASE_MAX_IDLE_CONNS")); err == nil {
+		sqlDB.SetMaxIdleConns(n)
+	}
+
+	if secs, err := strconv.Atoi(os.Getenv("DATABASE_CONN_MAX_LIFETIME")); err == nil {
+		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(secs))
+	}
+
+	return nil
+}
+
+// Open connects to the database without changing its schema
+func Open() (*gorm.DB, error) {
+	url := os.Getenv("DATABASE_URL")
+
 	// If running in a docker container don't allow the sqlite file to be created.
-	// The host should instead mount it using volumes
-	if util.IsRunningInDocker() {
-		if _, err := os.Stat("database.db"); err != nil {
-			if err == os.ErrNotExist {
-				return nil, fmt.Errorf("SQLite database file not mounted, please use docker volumes to mount it to /app/database.db")
-			}
+	// The host should instead mount it using volumes or use DATABASE_URL
+	if url == "" && util.IsRunningInDocker() {
+		if _, err := os.Stat(defaultSQLitePath); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("SQLite database file not mounted, please use docker volumes to mount it to /app/database.db or set DATABASE_URL")
 		}
 	}
 
-	db, err := gorm.Open(sqlite.Open("database.db"))
+	db, err := gorm.Open(dialector(url))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database, %w", err)
+	}
+
+	if err := configurePool(db); err != nil {
+		return nil, fmt.Errorf("failed to configure the connection pool, %w", err)
+	}
+
+	return db, nil
+}
+
+// New connects to the database, updates the schema of every table and runs
+// pending migrations
+func New() (*gorm.DB, error) {
+	db, err := Open()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize SQLite database, %w", err)
+		return nil, err
 	}
 
-	err = db.AutoMigrate(model.User{}, model.File{}, model.Stats{}, model.VerificationToken{}, model.ResendRequest{}, model.Migration{})
+	err = db.AutoMigrate(model.User{}, model.File{}, model.Stats{}, model.VerificationToken{}, model.ResendRequest{}, model.Migration{}, model.Subtitle{}, model.Watermark{}, model.Preset{}, model.FileVersion{}, model.Folder{}, model.Collection{}, model.CollectionFile{}, model.Tag{}, model.FileTag{}, model.Blob{}, model.Plan{}, model.StorageOp{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to automigrate tables, %w", err)
 	}
 
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
@@ -0,0 +1,749 @@
+//go:build integration
+
+// Runs the queries that differ between databases against every supported
+// engine. SQLite always runs, PostgreSQL only when TEST_DATABASE_URL points
+// to a database that can be wiped, a local one is enough:
+//
+//	initdb -D /tmp/vidsh-pg && pg_ctl -D /tmp/vidsh-pg -l /tmp/vidsh-pg.log start
+//	TEST_DATABASE_URL=postgres://$USER@localhost/postgres go test -tags integration ./db
+package db_test
+
+import (
+	"bitwise74/video-api/app/file"
+	"bitwise74/video-api/db"
+	"bitwise74/video-api/internal"
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// forEachEngine runs fn against a freshly migrated database of every engine
+func forEachEngine(t *testing.T, fn func(t *testing.T, conn *gorm.DB)) {
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, open(t, "sqlite://"+filepath.Join(t.TempDir(), "test.db")))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("TEST_DATABASE_URL")
+		if url == "" {
+			t.Skip("TEST_DATABASE_URL not set")
+		}
+
+		fn(t, open(t, url))
+	})
+}
+
+// open connects through DATABASE_URL the same way the server does. PostgreSQL
+// databases are emptied first so every test starts from the same schema
+func open(t *testing.T, url string) *gorm.DB {
+	t.Helper()
+	t.Setenv("DATABASE_URL", url)
+
+	conn, err := db.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conn.Dialector.Name() == "postgres" {
+		if err := conn.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public").Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeDB(t, conn)
+
+	conn, err = db.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeDB(t, conn) })
+
+	return conn
+}
+
+func closeDB(t *testing.T, conn *gorm.DB) {
+	t.Helper()
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+}
+
+func createUser(t *testing.T, conn *gorm.DB, id string, expiresAt *time.Time) {
+	t.Helper()
+
+	err := conn.Create(&model.User{
+		ID:           id,
+		Email:        id + "@example.com",
+		PasswordHash: "hash",
+		ExpiresAt:    expiresAt,
+		Stats:        model.Stats{UserID: id, MaxStorage: 1000},
+		VerificationTokens: []model.VerificationToken{
+			{Token: id, Purpose: "email_verify", ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createFile(t *testing.T, conn *gorm.DB, userID, key string, size int64) model.File {
+	t.Helper()
+
+	f := model.File{
+		UserID:       userID,
+		FileKey:      key,
+		OriginalName: key,
+		Size:         size,
+		CreatedAt:    time.Now().UnixMilli(),
+	}
+
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&f).Error; err != nil {
+			return err
+		}
+
+		return service.AcquireBlob(tx, f.FileKey, "sha", f.Size)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// waitFor polls cond until it's true or fails the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		pending, err := db.PendingMigrations(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 0 {
+			t.Fatalf("pending migrations after New: %v", pending)
+		}
+
+		if err := db.Migrate(conn); err != nil {
+			t.Fatalf("running migrations twice: %v", err)
+		}
+
+		if _, err := service.DefaultPlan(conn); err != nil {
+			t.Fatalf("default plan not seeded: %v", err)
+		}
+	})
+}
+
+func TestUserPlan(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "planless", nil)
+		createUser(t, conn, "pro", nil)
+
+		pro := &model.Plan{Name: "pro", MaxStorage: 5000, OutputFormats: model.StringSlice{"mp4"}}
+		if err := conn.Create(pro).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if err := service.AssignPlan(conn, pro, []string{"pro"}); err != nil {
+			t.Fatal(err)
+		}
+
+		plan, err := service.UserPlan(conn, "planless")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !plan.IsDefault {
+			t.Fatalf("user without a plan got %q, want the default plan", plan.Name)
+		}
+
+		plan, err = service.UserPlan(conn, "pro")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.ID != pro.ID || !plan.AllowsFormat("mp4") || plan.AllowsFormat("webm") {
+			t.Fatalf("got plan %+v, want %+v", plan, pro)
+		}
+
+		var stats model.Stats
+		if err := conn.Where("user_id = ?", "pro").First(&stats).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stats.MaxStorage != pro.MaxStorage {
+			t.Fatalf("max storage is %d, want %d", stats.MaxStorage, pro.MaxStorage)
+		}
+	})
+}
+
+func TestBlobRefCounts(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "owner", nil)
+		createFile(t, conn, "owner", "blobs/shared.mp4", 10)
+		createFile(t, conn, "owner", "blobs/shared.mp4", 10)
+
+		var blob model.Blob
+		if err := conn.Where("key = ?", "blobs/shared.mp4").First(&blob).Error; err != nil {
+			t.Fatal(err)
+		}
+		if blob.RefCount != 2 {
+			t.Fatalf("ref count is %d, want 2", blob.RefCount)
+		}
+
+		keys, err := service.ReleaseBlobs(conn, []string{"blobs/shared.mp4", "legacy.mp4"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != "legacy.mp4" {
+			t.Fatalf("deletable keys are %v, want only the legacy key", keys)
+		}
+
+		keys, err = service.ReleaseBlobs(conn, []string{"blobs/shared.mp4"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != "blobs/shared.mp4" {
+			t.Fatalf("deletable keys are %v, want the released blob", keys)
+		}
+	})
+}
+
+func TestBlobHolds(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		const key = "blobs/held.mp4"
+
+		// Two uploads of the same content in flight
+		for want := 1; want <= 2; want++ {
+			refs, err := service.HoldBlob(conn, key, "sha", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refs != want {
+				t.Fatalf("blob has %d references, want %d", refs, want)
+			}
+		}
+
+		queued := func() int64 {
+			var count int64
+			if err := conn.Model(model.StorageOp{}).Where("key = ?", key).Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			return count
+		}
+
+		// The first one is given up while the second is still uploading
+		if err := service.ReleaseHold(conn, key); err != nil {
+			t.Fatal(err)
+		}
+		if n := queued(); n != 0 {
+			t.Fatalf("%d deletes queued for a held blob", n)
+		}
+
+		// The second one is saved
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := service.AcquireBlob(tx, key, "sha", 10); err != nil {
+				return err
+			}
+
+			return service.ReleaseHold(tx, key)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var blob model.Blob
+		if err := conn.Where("key = ?", key).First(&blob).Error; err != nil {
+			t.Fatal(err)
+		}
+		if blob.RefCount != 1 {
+			t.Fatalf("ref count is %d, want the saved file only", blob.RefCount)
+		}
+
+		// A third one is given up with nothing else holding the blob
+		if _, err := service.ReleaseBlobs(conn, []string{key}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.HoldBlob(conn, key, "sha", 10); err != nil {
+			t.Fatal(err)
+		}
+		if err := service.ReleaseHold(conn, key); err != nil {
+			t.Fatal(err)
+		}
+		if n := queued(); n != 1 {
+			t.Fatalf("%d deletes queued for an unused blob, want 1", n)
+		}
+	})
+}
+
+func TestBlobClaims(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		const key = "blobs/claimed.mp4"
+
+		// The outbox is deleting the object
+		claim := model.Blob{Key: key, CreatedAt: time.Now().Unix(), DeletingAt: time.Now().Unix()}
+		if err := conn.Create(&claim).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		held := make(chan int, 1)
+		go func() {
+			refs, err := service.HoldBlob(conn, key, "sha", 10)
+			if err != nil {
+				t.Error(err)
+			}
+			held <- refs
+		}()
+
+		select {
+		case <-held:
+			t.Fatal("blob was held while its object was being deleted")
+		case <-time.After(300 * time.Millisecond):
+		}
+
+		// The deletion finishes and sees the upload holding the blob
+		if err := conn.Model(model.Blob{}).Where("key = ?", key).Update("deleting_at", 0).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case refs := <-held:
+			if refs != 1 {
+				t.Fatalf("blob has %d references, want the upload only", refs)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("blob wasn't held after the deletion finished")
+		}
+
+		// Claims of a crashed process are ignored
+		stale := time.Now().Add(-time.Hour).Unix()
+		if err := conn.Model(model.Blob{}).Where("key = ?", key).Update("deleting_at", stale).Error; err != nil {
+			t.Fatal(err)
+		}
+		refs, err := service.HoldBlob(conn, key, "sha", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refs != 2 {
+			t.Fatalf("blob has %d references, want 2", refs)
+		}
+	})
+}
+
+func TestPurgeFiles(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "gone", nil)
+		createUser(t, conn, "kept", nil)
+		createFile(t, conn, "gone", "blobs/a.mp4", 10)
+		createFile(t, conn, "gone", "blobs/b.mp4", 20)
+		createFile(t, conn, "kept", "blobs/a.mp4", 10)
+
+		for _, userID := range []string{"gone", "kept"} {
+			err := conn.
+				Model(model.Stats{}).
+				Where("user_id = ?", userID).
+				Updates(map[string]any{"used_storage": 30, "uploaded_files": 2}).
+				Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		purged, err := service.PurgeFiles(conn, "user_id IN ?", []string{"gone"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 2 {
+			t.Fatalf("purged %d files, want 2", purged)
+		}
+
+		var left int64
+		if err := conn.Model(model.File{}).Count(&left).Error; err != nil {
+			t.Fatal(err)
+		}
+		if left != 1 {
+			t.Fatalf("%d files left, want 1", left)
+		}
+
+		var queued []string
+		if err := conn.Model(model.StorageOp{}).Order("key").Pluck("key", &queued).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(queued) != 1 || queued[0] != "blobs/b.mp4" {
+			t.Fatalf("queued deletes are %v, want only the unshared blob", queued)
+		}
+
+		var stats model.Stats
+		if err := conn.Where("user_id = ?", "gone").First(&stats).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stats.UsedStorage != 0 || stats.UploadedFiles != 0 {
+			t.Fatalf("stats after purge are %+v, want nothing used", stats)
+		}
+	})
+}
+
+func TestPurgeSubtitles(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "owner", nil)
+		f := createFile(t, conn, "owner", "blobs/a.mp4", 10)
+
+		// Subtitles of older uploads took the prefix of the blob key
+		for _, key := range []string{"thumb_sub_abc123.vtt", "blobs/a_sub_def456.vtt"} {
+			err := conn.Create(&model.Subtitle{FileID: f.ID, UserID: "owner", Key: key, CreatedAt: 1}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := service.PurgeFiles(conn, "id = ?", f.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		var queued []string
+		if err := conn.Model(model.StorageOp{}).Order("key").Pluck("key", &queued).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"blobs/a.mp4", "blobs/a_sub_def456.vtt", "thumb_sub_abc123.vtt"}
+		if !slices.Equal(queued, want) {
+			t.Fatalf("queued deletes are %v, want %v", queued, want)
+		}
+	})
+}
+
+func TestReconcileStats(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "drifted", nil)
+		f := createFile(t, conn, "drifted", "blobs/c.mp4", 100)
+		createFile(t, conn, "drifted", "legacy.mp4", 50)
+
+		err := conn.Create(&model.FileVersion{FileID: f.ID, Number: 1, FileKey: "blobs/c1.mp4", Size: 70}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := service.ReconcileStats(conn, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Users != 1 || report.FixedUsers != 1 {
+			t.Fatalf("got report %+v, want one fixed user", report)
+		}
+
+		var stats model.Stats
+		if err := conn.Where("user_id = ?", "drifted").First(&stats).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stats.UsedStorage != 120 || stats.UploadedFiles != 2 {
+			t.Fatalf("stats are %+v, want 120 bytes in 2 files", stats)
+		}
+	})
+}
+
+func TestPaginate(t *testing.T) {
+	sort := &service.Sort[model.Preset]{
+		Name:   "name",
+		Column: "presets.name",
+		ID:     "presets.id",
+		Key:    func(p *model.Preset) (any, uint) { return p.Name, p.ID },
+	}
+
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "owner", nil)
+
+		// Duplicate names make sure ties are broken by the ID
+		for _, name := range []string{"b", "a", "c", "b", "d"} {
+			err := conn.Create(&model.Preset{UserID: "owner", Name: name, Options: json.RawMessage("{}"), CreatedAt: 1}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var names []string
+		var cursor *service.Cursor
+
+		for {
+			page, err := service.Paginate(conn.Model(model.Preset{}).Where("user_id = ?", "owner"), sort, cursor, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case cursor == nil && (page.TotalEstimate == nil || *page.TotalEstimate != 5):
+				t.Fatalf("total estimate of the first page is %v, want 5", page.TotalEstimate)
+			case cursor != nil && page.TotalEstimate != nil:
+				t.Fatalf("total estimate of a later page is %d, want none", *page.TotalEstimate)
+			}
+
+			for _, p := range page.Items {
+				names = append(names, p.Name)
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+
+			cursor, err = service.DecodeCursor(page.NextCursor, sort.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := fmt.Sprint(names); got != "[a b b c d]" {
+			t.Fatalf("walked pages in order %s", got)
+		}
+	})
+}
+
+func TestTokenCleanup(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "owner", nil)
+
+		for _, token := range []string{"expired-1", "expired-2"} {
+			err := conn.Create(&model.VerificationToken{UserID: "owner", Token: token, ExpiresAt: time.Now().Add(-time.Hour)}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		service.TokenCleanup(10*time.Millisecond, conn)
+
+		waitFor(t, "the expired tokens to be deleted", func() bool {
+			var count int64
+			conn.Model(model.VerificationToken{}).Where("token IN ?", []string{"expired-1", "expired-2"}).Count(&count)
+			return count == 0
+		})
+
+		var left int64
+		if err := conn.Model(model.VerificationToken{}).Count(&left).Error; err != nil {
+			t.Fatal(err)
+		}
+		if left != 1 {
+			t.Fatalf("%d tokens left, want the valid one", left)
+		}
+	})
+}
+
+func TestAccountCleanup(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		expired := time.Now().Add(-time.Hour)
+
+		createUser(t, conn, "unverified", &expired)
+		createUser(t, conn, "verified", nil)
+		createFile(t, conn, "unverified", "blobs/d.mp4", 10)
+
+		owned := []any{
+			&model.Watermark{UserID: "unverified", Name: "logo", Type: "image", ImageKey: "watermarks/logo.png"},
+			&model.Preset{UserID: "unverified", Name: "small", Options: json.RawMessage("{}")},
+			&model.Folder{UserID: "unverified", Name: "clips"},
+			&model.Collection{UserID: "unverified", Name: "best"},
+			&model.Tag{UserID: "unverified", Name: "funny"},
+		}
+		for _, row := range owned {
+			if err := conn.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		service.AccountCleanup(10*time.Millisecond, conn)
+
+		waitFor(t, "the unverified user to be deleted", func() bool {
+			var count int64
+			conn.Model(model.User{}).Where("id = ?", "unverified").Count(&count)
+			return count == 0
+		})
+
+		for _, m := range []any{model.Stats{}, model.VerificationToken{}, model.File{}, model.Watermark{}, model.Preset{}, model.Folder{}, model.Collection{}, model.Tag{}} {
+			var count int64
+			if err := conn.Model(m).Where("user_id = ?", "unverified").Count(&count).Error; err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Fatalf("%d %T rows of the deleted user left", count, m)
+			}
+		}
+
+		var queued []string
+		if err := conn.Model(model.StorageOp{}).Order("key").Pluck("key", &queued).Error; err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(queued) != "[blobs/d.mp4 watermarks/logo.png]" {
+			t.Fatalf("queued deletes are %v, want the file and the watermark image", queued)
+		}
+
+		var users int64
+		if err := conn.Model(model.User{}).Count(&users).Error; err != nil {
+			t.Fatal(err)
+		}
+		if users != 1 {
+			t.Fatalf("%d users left, want the verified one", users)
+		}
+	})
+}
+
+type searchPage struct {
+	Items []struct {
+		ID   uint   `json:"id"`
+		Name string `json:"name"`
+	} `json:"items"`
+	NextCursor    string `json:"next_cursor"`
+	TotalEstimate int64  `json:"total_estimate"`
+}
+
+// search runs FileSearch as userID with the query string of a request
+func search(t *testing.T, d *internal.Deps, userID, query string) *searchPage {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/files/search?"+query, nil)
+	c.Set("requestID", "test")
+	c.Set("userID", userID)
+
+	file.FileSearch(c, d)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("search %q responded with %d: %s", query, w.Code, w.Body)
+	}
+
+	var page searchPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	return &page
+}
+
+func TestFileSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		d := &internal.Deps{DB: conn, FullTextSearch: service.SetupSearch(conn)}
+
+		createUser(t, conn, "owner", nil)
+		createFile(t, conn, "owner", "cat-video.mp4", 10)
+		trashed := createFile(t, conn, "owner", "cat-trashed.mp4", 10)
+
+		err := conn.Model(&trashed).Update("deleted_at", time.Now().Unix()).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page := search(t, d, "owner", "query=cat")
+		if len(page.Items) != 1 || page.TotalEstimate != 1 {
+			t.Fatalf("got %d items of %d, want only the live file", len(page.Items), page.TotalEstimate)
+		}
+
+		page = search(t, d, "owner", "")
+		if len(page.Items) != 1 || page.TotalEstimate != 1 {
+			t.Fatalf("got %d items of %d without a query, want only the live file", len(page.Items), page.TotalEstimate)
+		}
+
+		tagged := createFile(t, conn, "owner", "tagged.mp4", 10)
+		tag := model.Tag{UserID: "owner", Name: "holiday", CreatedAt: time.Now().Unix()}
+		if err := conn.Create(&tag).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.Create(&model.FileTag{FileID: tagged.ID, TagID: tag.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		subtitled := createFile(t, conn, "owner", "subtitled.mp4", 10)
+		err = conn.Create(&model.Subtitle{
+			FileID:    subtitled.ID,
+			UserID:    "owner",
+			Key:       "subtitled.vtt",
+			Text:      "hello world",
+			CreatedAt: time.Now().Unix(),
+		}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		createFile(t, conn, "owner", "100% done.mp4", 10)
+
+		tests := []struct {
+			query string
+			want  string
+		}{
+			{"query=holi", "tagged.mp4"},
+			{"query=world", "subtitled.mp4"},
+			{"query=" + url.QueryEscape("%"), "100% done.mp4"},
+		}
+
+		for _, tt := range tests {
+			page := search(t, d, "owner", tt.query)
+			if len(page.Items) != 1 || page.Items[0].Name != tt.want {
+				t.Fatalf("search %q found %+v, want only %s", tt.query, page.Items, tt.want)
+			}
+		}
+	})
+}
+
+func TestFindDuplicates(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, conn *gorm.DB) {
+		createUser(t, conn, "owner", nil)
+
+		// a and b are copies, c looks like a and d looks like nothing
+		fingerprints := map[string]string{
+			"a.mp4": strings.Repeat("00", 8),
+			"b.mp4": strings.Repeat("00", 8),
+			"c.mp4": "01" + strings.Repeat("00", 7),
+			"d.mp4": strings.Repeat("ff", 8),
+		}
+		shas := map[string]string{"a.mp4": "same", "b.mp4": "same", "c.mp4": "other", "d.mp4": "unique"}
+
+		for _, key := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"} {
+			f := createFile(t, conn, "owner", key, 10)
+
+			err := conn.
+				Model(&f).
+				Updates(map[string]any{"sha256": shas[key], "fingerprint": fingerprints[key]}).
+				Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		groups, err := service.FindDuplicates(conn, "owner")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, g := range groups {
+			names := []string{}
+			for _, f := range g.Files {
+				names = append(names, f.FileKey)
+			}
+			got = append(got, g.Match+" "+strings.Join(names, ","))
+		}
+
+		want := []string{"exact a.mp4,b.mp4", "similar a.mp4,b.mp4,c.mp4"}
+		if !slices.Equal(got, want) {
+			t.Fatalf("got groups %q, want %q", got, want)
+		}
+	})
+}
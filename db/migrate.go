@@ -0,0 +1,90 @@
+package db
+
+import (
+	"bitwise74/video-api/internal/model"
+	"fmt"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// migration changes data in a way AutoMigrate can't. It runs once, after
+// AutoMigrate, in its own transaction
+type migration struct {
+	Name string // Recorded in the migrations table, never rename a released one
+	Up   func(tx *gorm.DB) error
+}
+
+// Every migration in the order it runs in. New ones go at the end
+var migrations = []migration{
+	{Name: "file_tags", Up: migrateTags},
+	{Name: "plans", Up: migratePlans},
+}
+
+// appliedMigrations returns the names of the migrations that ran already
+func appliedMigrations(db *gorm.DB) (map[string]bool, error) {
+	applied := map[string]bool{}
+
+	if !db.Migrator().HasTable(&model.Migration{}) {
+		return applied, nil
+	}
+
+	var names []string
+	if err := db.Model(model.Migration{}).Pluck("name", &names).Error; err != nil {
+		return nil, err
+	}
+
+	for _, n := range names {
+		applied[n] = true
+	}
+
+	return applied, nil
+}
+
+// PendingMigrations returns the names of the migrations that haven't run yet
+// without changing anything
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []string{}
+	for _, m := range migrations {
+		if !applied[m.Name] {
+			pending = append(pending, m.Name)
+		}
+	}
+
+	return pending, nil
+}
+
+// Migrate runs every pending migration in order. A failed migration is
+// rolled back and stops the ones after it
+func Migrate(db *gorm.DB) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Name] {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&model.Migration{Name: m.Name}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed, %w", m.Name, err)
+		}
+
+		zap.L().Info("Applied migration", zap.String("name", m.Name))
+	}
+
+	return nil
+}
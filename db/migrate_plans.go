@@ -0,0 +1,30 @@
+package db
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// migratePlans creates the default plan from the storage and upload limits
+// in the environment and assigns it to every existing user. The plan is
+// managed through the admin API afterwards
+func migratePlans(tx *gorm.DB) error {
+	plan := service.PlanFromEnv()
+	if err := tx.Create(plan).Error; err != nil {
+		return err
+	}
+
+	res := tx.
+		Model(model.User{}).
+		Where("plan_id IS NULL").
+		Update("plan_id", plan.ID)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	zap.L().Info("Assigned the default plan", zap.Int64("users", res.RowsAffected))
+	return nil
+}
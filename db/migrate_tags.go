@@ -0,0 +1,71 @@
+package db
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/internal/service"
+	"bitwise74/video-api/pkg/validators"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// migrateTags moves the tags stored as a comma separated list in the files
+// table into the tags and file_tags tables. The old column is left alone
+func migrateTags(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&model.File{}, "tags") {
+		return nil
+	}
+
+	var rows []struct {
+		ID     uint
+		UserID string
+		Tags   model.StringSlice
+	}
+
+	err := tx.
+		Table("files").
+		Select("id", "user_id", "tags").
+		Where("tags IS NOT NULL AND tags != ''").
+		Scan(&rows).
+		Error
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		names := []string{}
+		for _, t := range r.Tags {
+			t, err := validators.NormalizeTag(t)
+			if err != nil {
+				zap.L().Warn("Dropping invalid tag", zap.Uint("file_id", r.ID), zap.Error(err))
+				continue
+			}
+			names = append(names, t)
+		}
+
+		slices.Sort(names)
+		names = slices.Compact(names)
+
+		if len(names) == 0 {
+			continue
+		}
+
+		if len(names) > validators.MaxFileTags {
+			names = names[:validators.MaxFileTags]
+		}
+
+		tags, err := service.EnsureTags(tx, r.UserID, names)
+		if err != nil {
+			return fmt.Errorf("failed to create tags, %w", err)
+		}
+
+		if err := service.AddFileTags(tx, r.ID, tags); err != nil {
+			return fmt.Errorf("failed to tag file %d, %w", r.ID, err)
+		}
+	}
+
+	zap.L().Info("Migrated file tags", zap.Int("files", len(rows)))
+	return nil
+}
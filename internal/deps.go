@@ -14,4 +14,7 @@ type Deps struct {
 	S3       *aws.S3Client
 	JobQueue *service.JobQueue
 	Uploader *service.Uploader
+
+	// Set if the database is SQLite built with FTS5, searches use LIKE otherwise
+	FullTextSearch bool
 }
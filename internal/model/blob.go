@@ -0,0 +1,15 @@
+package model
+
+// Blob is a stored video object shared by every file and version with the
+// same content. RefCount is how many file and version rows point to it plus
+// the uploads in progress holding it, the object is only deleted once it
+// drops to zero. DeletingAt is set while the object is being deleted,
+// uploads of the same content wait for it to be cleared
+type Blob struct {
+	Key        string `gorm:"primaryKey"`
+	SHA256     string `gorm:"index;not null"`
+	Size       int64  `gorm:"not null"`
+	RefCount   int    `gorm:"not null;default:0"`
+	CreatedAt  int64  `gorm:"not null"`
+	DeletingAt int64  `gorm:"not null;default:0"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// Collection is a named list of files. Unlike folders a file can be in
+// any amount of collections
+type Collection struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string `gorm:"index;not null" json:"-"`
+	Name      string `gorm:"not null" json:"name"`
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+
+	FileCount int64 `gorm:"->;-:migration" json:"file_count"`
+}
+
+// CollectionFile links a file to a collection
+type CollectionFile struct {
+	CollectionID uint  `gorm:"primaryKey" json:"collection_id"`
+	FileID       uint  `gorm:"primaryKey;index" json:"file_id"`
+	AddedAt      int64 `gorm:"not null" json:"added_at"`
+}
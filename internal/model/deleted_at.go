@@ -0,0 +1,59 @@
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DeletedAt marks a row as soft deleted with a unix timestamp. Queries and
+// updates on models with this field skip deleted rows unless Unscoped is
+// used. Unlike gorm.DeletedAt, Delete still removes the row for good so rows
+// are soft deleted with an explicit update
+type DeletedAt sql.NullInt64
+
+// Scan implements the sql.Scanner interface
+func (d *DeletedAt) Scan(value any) error {
+	return (*sql.NullInt64)(d).Scan(value)
+}
+
+// Value implements the driver.Valuer interface
+func (d DeletedAt) Value() (driver.Value, error) {
+	if !d.Valid {
+		return nil, nil
+	}
+
+	return d.Int64, nil
+}
+
+func (d DeletedAt) MarshalJSON() ([]byte, error) {
+	if !d.Valid {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(d.Int64)
+}
+
+func (d *DeletedAt) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		d.Valid = false
+		return nil
+	}
+
+	err := json.Unmarshal(b, &d.Int64)
+	d.Valid = err == nil
+
+	return err
+}
+
+func (DeletedAt) QueryClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{gorm.SoftDeleteQueryClause{Field: f}}
+}
+
+func (DeletedAt) UpdateClauses(f *schema.Field) []clause.Interface {
+	return []clause.Interface{gorm.SoftDeleteUpdateClause{Field: f}}
+}
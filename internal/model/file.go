@@ -1,20 +1,55 @@
 // Package model defines database models
 package model
 
+import "strconv"
+
 type File struct {
-	ID           uint        `gorm:"primaryKey;autoIncrement;index" json:"id"`
-	UserID       string      `json:"-"`
-	FileKey      string      `json:"file_key"`  // Avoids file name conflicts
-	ThumbKey     string      `json:"thumb_key"` // TODO: drop this column its not mandatory
-	OriginalName string      `json:"name"`      // Original file name before turning it into a special S3 key
-	Private      bool        `json:"private"`
-	Format       string      `json:"format"`
-	Views        int32       `json:"views"` // TODO: implement
-	Size         int64       `json:"size"`
-	Tags         StringSlice `json:"tags"`
-	State        string      `json:"state"` // Used to inform the frontend/backend if the file is being processed/uploaded
-	Version      int         `gorm:"default:1" json:"version"`
-	Duration     float64     `json:"duration"` // All are unix millisecond timestamps
-	CreatedAt    int64       `gorm:"not null" json:"created_at"`
-	ExpiresAt    *int64      `json:"expires_at,omitzero"`
+	ID           uint      `gorm:"primaryKey;autoIncrement;index" json:"id"`
+	UserID       string    `json:"-"`
+	FileKey      string    `json:"file_key"`  // Avoids file name conflicts
+	ThumbKey     string    `json:"thumb_key"` // TODO: drop this column its not mandatory
+	SpriteKey    string    `json:"sprite_key,omitempty"`
+	SpriteVTTKey string    `json:"sprite_vtt_key,omitempty"` // WebVTT track mapping time ranges to SpriteKey tiles
+	PreviewKey   string    `json:"preview_key,omitempty"`    // Short muted clip shown on hover
+	OriginalName string    `json:"name"`                     // Original file name before turning it into a special S3 key
+	Description  string    `json:"description"`
+	Private      bool      `json:"private"`
+	FolderID     *uint     `gorm:"index" json:"folder_id"` // Nil when the file is at the root of the library
+	Format       string    `json:"format"`
+	Views        int32     `json:"views"` // TODO: implement
+	Size         int64     `json:"size"`
+	SHA256       string    `gorm:"index" json:"sha256"` // Of the uploaded bytes, or of the stored video for edits, exports and older uploads
+	Fingerprint  string    `json:"-"`                   // Perceptual hash of sampled frames, see service.MakeFingerprint
+	Tags         []string  `gorm:"-" json:"tags"`       // Loaded from the file_tags table
+	State        string    `json:"state"`               // Used to inform the frontend/backend if the file is being processed/uploaded
+	Version      int       `gorm:"default:1" json:"version"`
+	Duration     float64   `json:"duration"` // All are unix millisecond timestamps
+	CreatedAt    int64     `gorm:"not null" json:"created_at"`
+	ExpiresAt    *int64    `json:"expires_at,omitzero"`
+	DeletedAt    DeletedAt `gorm:"index" json:"deleted_at,omitzero"` // Set while the file is in the trash
+}
+
+// ObjectKeys returns the keys of every S3 object that belongs to the file
+func (f *File) ObjectKeys() []string {
+	keys := []string{}
+
+	for _, k := range []string{f.FileKey, f.ThumbKey, f.SpriteKey, f.SpriteVTTKey, f.PreviewKey} {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// VersionKeys appends the file version to every key so clients
+// don't use cached objects after an edit
+func (f *File) VersionKeys() {
+	v := "?v=" + strconv.Itoa(f.Version)
+
+	for _, k := range []*string{&f.FileKey, &f.ThumbKey, &f.SpriteKey, &f.SpriteVTTKey, &f.PreviewKey} {
+		if *k != "" {
+			*k += v
+		}
+	}
 }
@@ -0,0 +1,34 @@
+package model
+
+import "encoding/json"
+
+// FileVersion is a retained render of a file. Every processing edit adds one
+// and the file itself always points to the objects of one of them
+type FileVersion struct {
+	ID        uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID    uint            `gorm:"index;not null" json:"file_id"`
+	UserID    string          `gorm:"index;not null" json:"-"`
+	Number    int             `gorm:"not null" json:"number"` // Starts at 1 for the original upload
+	FileKey   string          `gorm:"not null" json:"file_key"`
+	ThumbKey  string          `json:"thumb_key"`
+	Size      int64           `json:"size"`
+	SHA256    string          `json:"sha256"`
+	Duration  float64         `json:"duration"`
+	Options   json.RawMessage `json:"options,omitempty"` // ProcessingOptions that produced the version, empty for the original
+	CreatedAt int64           `gorm:"not null" json:"created_at"`
+
+	Current bool `gorm:"-" json:"current"`
+}
+
+// ObjectKeys returns the keys of every S3 object that belongs to the version
+func (v *FileVersion) ObjectKeys() []string {
+	keys := []string{}
+
+	for _, k := range []string{v.FileKey, v.ThumbKey} {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
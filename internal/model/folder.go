@@ -0,0 +1,11 @@
+package model
+
+// Folder groups a user's files. Folders without a parent are at the root
+// of the library
+type Folder struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string `gorm:"index;not null" json:"-"`
+	ParentID  *uint  `gorm:"index" json:"parent_id"`
+	Name      string `gorm:"not null" json:"name"`
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+}
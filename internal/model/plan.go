@@ -0,0 +1,23 @@
+package model
+
+import "slices"
+
+// Plan holds the limits of every user assigned to it. Zero limits other than
+// the storage mean no limit
+type Plan struct {
+	ID                uint        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name              string      `gorm:"unique;not null" json:"name"`
+	MaxStorage        int64       `gorm:"not null" json:"max_storage"`  // In bytes, copied to Stats.MaxStorage of the plan's users
+	MaxUploadSize     int64       `json:"max_upload_size"`              // In bytes
+	MaxConcurrentJobs int         `json:"max_concurrent_jobs"`          // FFmpeg jobs a user can have queued or running
+	MaxDuration       float64     `json:"max_duration"`                 // In seconds, applies to uploads and outputs
+	OutputFormats     StringSlice `json:"output_formats"`               // mp4, audio, gif or webp. Empty allows every format
+	HLS               bool        `json:"hls"`                          // Reserved for adaptive streaming
+	IsDefault         bool        `gorm:"default:false" json:"default"` // Given to new users
+	CreatedAt         int64       `gorm:"not null" json:"created_at"`
+}
+
+// AllowsFormat reports if users of the plan can produce outputs in a format
+func (p *Plan) AllowsFormat(format string) bool {
+	return len(p.OutputFormats) == 0 || slices.Contains(p.OutputFormats, format)
+}
@@ -0,0 +1,12 @@
+package model
+
+import "encoding/json"
+
+// Preset is a named set of processing options saved by a user
+type Preset struct {
+	ID        uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string          `gorm:"index;not null" json:"-"`
+	Name      string          `gorm:"not null" json:"name"`
+	Options   json.RawMessage `gorm:"not null" json:"options"` // JSON encoded validators.ProcessingOptions
+	CreatedAt int64           `gorm:"not null" json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// StorageOp is an S3 operation written in the same transaction as the rows
+// it belongs to. A worker performs it after the commit and retries it until
+// it succeeds so the bucket always catches up with the database
+type StorageOp struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement"`
+	Op            string `gorm:"not null"` // Only delete for now
+	Key           string `gorm:"not null"`
+	Attempts      int    `gorm:"not null;default:0"`
+	NextAttemptAt int64  `gorm:"index;not null"`
+	LastError     string
+	CreatedAt     int64  `gorm:"not null"`
+	DoneAt        *int64 `gorm:"index"`
+}
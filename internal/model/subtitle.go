@@ -0,0 +1,12 @@
+package model
+
+type Subtitle struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	FileID    uint   `gorm:"index;not null" json:"file_id"`
+	UserID    string `gorm:"index;not null" json:"-"`
+	Language  string `json:"language"` // BCP 47 tag, e.g. en or pt-BR
+	Label     string `json:"label"`
+	Key       string `json:"key"`                // Always a WebVTT file
+	Text      string `gorm:"type:text" json:"-"` // Cue text without timings, used for search
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+}
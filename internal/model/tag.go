@@ -0,0 +1,18 @@
+package model
+
+// Tag is a label a user can put on any amount of their files. Names are
+// unique per user
+type Tag struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string `gorm:"uniqueIndex:idx_tags_user_name;not null" json:"-"`
+	Name      string `gorm:"uniqueIndex:idx_tags_user_name;not null" json:"name"`
+	CreatedAt int64  `gorm:"not null" json:"created_at"`
+
+	FileCount int64 `gorm:"->;-:migration" json:"file_count"`
+}
+
+// FileTag links a tag to a file
+type FileTag struct {
+	FileID uint `gorm:"primaryKey" json:"file_id"`
+	TagID  uint `gorm:"primaryKey;index" json:"tag_id"`
+}
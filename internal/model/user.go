@@ -9,6 +9,12 @@ type User struct {
 	Verified     bool   `gorm:"default:false"`
 	ExpiresAt    *time.Time
 
+	// What happens when an upload has the same content as a stored file,
+	// either warn or refuse
+	DuplicatePolicy string `gorm:"default:warn"`
+
+	PlanID *uint `gorm:"index"` // Nil only for users made before plans existed
+
 	VerificationTokens []VerificationToken `gorm:"foreignKey:UserID"`
 	Files              []File              `gorm:"foreignKey:UserID"`
 	Stats              Stats               `gorm:"foreignKey:UserID"`
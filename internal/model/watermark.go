@@ -0,0 +1,16 @@
+package model
+
+// Watermark is a per-user overlay preset that can be applied while processing
+type Watermark struct {
+	ID        uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string  `gorm:"index;not null" json:"-"`
+	Name      string  `gorm:"not null" json:"name"`
+	Type      string  `gorm:"not null" json:"type"` // image or text
+	ImageKey  string  `json:"image_key,omitempty"`  // PNG stored in S3, only for image watermarks
+	Text      string  `json:"text,omitempty"`
+	Position  string  `json:"position"` // top-left, top-right, bottom-left, bottom-right or center
+	Margin    int     `json:"margin"`   // In pixels
+	Opacity   float64 `json:"opacity"`
+	Scale     float64 `json:"scale"` // Fraction of the video width for images and of the height for text
+	CreatedAt int64   `gorm:"not null" json:"created_at"`
+}
@@ -2,13 +2,8 @@ package service
 
 import (
 	"bitwise74/video-api/internal/model"
-	"context"
-	"os"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -21,7 +16,7 @@ type partialUser struct {
 // verification and didn't verify after 30 days from the update.
 // Also deletes accounts that should have verified their account
 // after registration but didn't
-func AccountCleanup(t time.Duration, db *gorm.DB, c *s3.Client) {
+func AccountCleanup(t time.Duration, db *gorm.DB) {
 	ticker := time.NewTicker(t)
 
 	zap.L().Debug("Account cleanup attached", zap.Duration("tick_every", t))
@@ -33,8 +28,7 @@ func AccountCleanup(t time.Duration, db *gorm.DB, c *s3.Client) {
 			err := db.
 				Model(model.User{}).
 				Where("expires_at < ?", time.Now()).
-				Select("id").
-				Find(&toCleanUserIds).
+				Pluck("id", &toCleanUserIds).
 				Error
 			if err != nil {
 				zap.L().Error("Failed to query db for users to clean", zap.Error(err))
@@ -45,48 +39,41 @@ func AccountCleanup(t time.Duration, db *gorm.DB, c *s3.Client) {
 				continue
 			}
 
-			// If we have any users to delete also get their files to delete from S3
-			var toCleanFileKeys []string
-
-			err = db.
-				Model(model.File{}).
-				Where("user_id LIKE ?", toCleanUserIds).
-				Select("file_key", "thumb_key").
-				Find(&toCleanFileKeys).
-				Error
-			if err != nil {
-				zap.L().Error("Failed to query db for files to delete", zap.Error(err))
+			// Files go first so blobs shared with other users are kept
+			if _, err := PurgeFiles(db, "user_id IN ?", toCleanUserIds); err != nil {
+				zap.L().Error("Failed to delete files of users to clean", zap.Error(err))
 				continue
 			}
 
-			// Try deleting files from S3
-			if len(toCleanFileKeys) > 0 {
-				// S3 can delete at most 1000 files in one batch request.
-				// We have to split the slice in len = 1000 parts
-				for start := 0; start < len(toCleanFileKeys); start += 1000 {
-					end := min(start+1000, len(toCleanFileKeys))
+			// Delete users now along with everything else they own. Rows with a
+			// foreign key to them go first as PostgreSQL enforces the constraints
+			err = db.Transaction(func(tx *gorm.DB) error {
+				var imageKeys []string
+				err := tx.
+					Model(model.Watermark{}).
+					Where("user_id IN ? AND image_key != ''", toCleanUserIds).
+					Pluck("image_key", &imageKeys).
+					Error
+				if err != nil {
+					return err
+				}
 
-					objects := make([]types.ObjectIdentifier, end-start)
-					for i, key := range toCleanFileKeys[start:end] {
-						objects[i] = types.ObjectIdentifier{Key: &key}
-					}
+				if err := EnqueueDeletes(tx, imageKeys); err != nil {
+					return err
+				}
 
-					if _, err := c.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
-						Bucket: aws.String(os.Getenv("BUCKET")),
-						Delete: &types.Delete{
-							Objects: objects,
-						},
-					}); err != nil {
-						zap.L().Error("Failed to delete files from S3", zap.Error(err))
+				// Entries of files were removed with the files already
+				for _, m := range []any{model.Watermark{}, model.Preset{}, model.Folder{}, model.Collection{}, model.Tag{}, model.Stats{}, model.VerificationToken{}, model.ResendRequest{}} {
+					if err := tx.Where("user_id IN ?", toCleanUserIds).Delete(m).Error; err != nil {
+						return err
 					}
 				}
-			}
 
-			// Delete users now
-			err = db.
-				Where("user_id LIKE ?", toCleanUserIds).
-				Delete(model.User{}).
-				Error
+				return tx.
+					Where("id IN ?", toCleanUserIds).
+					Delete(model.User{}).
+					Error
+			})
 			if err != nil {
 				zap.L().Error("Failed to delete users from database", zap.Error(err))
 			}
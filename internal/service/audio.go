@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EBU R128 targets used by the loudnorm filter
+const (
+	loudnormI   = -16.0
+	loudnormTP  = -1.5
+	loudnormLRA = 11.0
+)
+
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// GetAudioStreamCount returns the amount of audio streams in a file
+func GetAudioStreamCount(p string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "a", "-show_entries", "stream=index", "-of", "csv=p=0", "-i", p)
+
+	var stdOut, stdErr bytes.Buffer
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe failed, %w (%s)", err, stdErr.String())
+	}
+
+	out := strings.TrimSpace(stdOut.String())
+	if out == "" {
+		return 0, nil
+	}
+
+	return len(strings.Split(out, "\n")), nil
+}
+
+// MeasureLoudness runs the first loudnorm pass over the selected part of
+// the audio track and returns the measured values
+func MeasureLoudness(p string, opts *validators.ProcessingOptions) (*loudnormStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	zap.L().Debug("Running first loudnorm pass")
+
+	args := []string{"-hide_banner", "-nostats", "-i", p}
+	if opts.TrimStart > 0 {
+		args = append(args, "-ss", util.FloatToTimestamp(opts.TrimStart))
+	}
+	if opts.TrimEnd > 0 {
+		args = append(args, "-to", util.FloatToTimestamp(opts.TrimEnd))
+	}
+
+	args = append(args,
+		"-map", fmt.Sprintf("0:a:%d", opts.AudioTrack),
+		"-af", fmt.Sprintf("loudnorm=I=%.1f:TP=%.1f:LRA=%.1f:print_format=json", loudnormI, loudnormTP, loudnormLRA),
+		"-f", "null", "-",
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+
+	var stdErr bytes.Buffer
+	cmd.Stderr = &stdErr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("loudnorm measurement failed, %w (%s)", err, stdErr.String())
+	}
+
+	// The stats are printed as the last JSON object in stderr
+	out := stdErr.String()
+	start := strings.LastIndex(out, "{")
+	end := strings.LastIndex(out, "}")
+	if start == -1 || end < start {
+		return nil, errors.New("no loudnorm stats found in ffmpeg output")
+	}
+
+	var stats loudnormStats
+	if err := json.Unmarshal([]byte(out[start:end+1]), &stats); err != nil {
+		return nil, fmt.Errorf("malformed loudnorm stats, %w", err)
+	}
+
+	// Silent inputs report -inf which loudnorm won't accept back
+	if _, err := strconv.ParseFloat(stats.InputI, 64); err != nil {
+		return nil, fmt.Errorf("audio track is silent or unmeasurable (%s)", stats.InputI)
+	}
+
+	zap.L().Debug("Loudnorm pass finished", zap.String("input_i", stats.InputI))
+	return &stats, nil
+}
+
+// makeAudioFlags returns the arguments for the audio encode. Stream mapping
+// is left to the caller. The returned bitrate is 0 if the output has no audio
+// or the audio is copied
+func makeAudioFlags(opts *validators.ProcessingOptions, p string, duration float64) ([]string, int, error) {
+	if opts.RemoveAudio {
+		return []string{"-an"}, 0, nil
+	}
+
+	args := []string{}
+
+	if opts.AudioTrack > 0 {
+		count, err := GetAudioStreamCount(p)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if opts.AudioTrack >= count {
+			return nil, 0, fmt.Errorf("audio track %d doesn't exist, file has %d", opts.AudioTrack, count)
+		}
+	}
+
+	if opts.AudioOnly {
+		args = append(args, "-vn")
+	}
+
+	if !opts.TouchesAudio() {
+		return append(args, "-c:a", "copy"), 0, nil
+	}
+
+	filters := []string{}
+
+	if opts.NormalizeAudio {
+		stats, err := MeasureLoudness(p, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		filters = append(filters, fmt.Sprintf(
+			"loudnorm=I=%.1f:TP=%.1f:LRA=%.1f:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+			loudnormI, loudnormTP, loudnormLRA,
+			stats.InputI, stats.InputTP, stats.InputLRA, stats.InputThresh, stats.TargetOffset,
+		))
+	}
+
+	// Gain is applied after normalization so it acts as a boost on top of it
+	if opts.VolumeGain != 0 {
+		filters = append(filters, fmt.Sprintf("volume=%.2fdB", opts.VolumeGain))
+	}
+
+	if len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+
+	bitrate := opts.AudioBitrate
+	if bitrate == 0 {
+		bitrate = validators.DefaultAudioBitrate
+
+		// Audio-only exports can use the whole target size
+		if opts.AudioOnly && opts.TargetSize > 0 {
+			bitrate = int(min(max(targetBitrateKbps(opts.TargetSize, duration), 32), 320))
+		}
+	}
+
+	args = append(args, "-c:a", "aac", "-b:a", strconv.Itoa(bitrate)+"k")
+
+	return args, bitrate, nil
+}
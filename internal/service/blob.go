@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	blobPrefix        = "blobs/"
+	blobDeleteTimeout = time.Minute // Longest a claimed blob takes to delete
+	blobClaimPoll     = 100 * time.Millisecond
+)
+
+// blobKey returns the content addressed key of a video. Files with the
+// same content share the object
+func blobKey(sha, ext string) string {
+	return blobPrefix + sha + ext
+}
+
+// isBlobKey reports if a key is content addressed. Objects stored before
+// blobs existed belong to a single file and aren't reference counted. Only
+// videos and animations are blobs, subtitles once took the prefix from the
+// video key but belong to their file
+func isBlobKey(key string) bool {
+	if !strings.HasPrefix(key, blobPrefix) {
+		return false
+	}
+
+	for _, ext := range formatExts {
+		if strings.HasSuffix(key, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimBlob marks a blob nothing references as being deleted and reports
+// if it did. Uploads holding the blob meanwhile wait in HoldBlob until
+// releaseBlob ends the claim, so the object is never deleted after an
+// upload found it stored
+func claimBlob(db *gorm.DB, key string) (bool, error) {
+	now := time.Now().Unix()
+
+	res := db.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]any{"deleting_at": now}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "blobs.ref_count <= 0"},
+			}},
+		}).
+		Create(&model.Blob{
+			Key:        key,
+			CreatedAt:  now,
+			DeletingAt: now,
+		})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+// releaseBlob ends the claim on a blob once its object was deleted or
+// failed to. The row is dropped unless an upload held the blob meanwhile,
+// that upload stores the object again
+func releaseBlob(db *gorm.DB, key string) error {
+	err := db.
+		Where("key = ? AND ref_count <= 0", key).
+		Delete(model.Blob{}).
+		Error
+	if err != nil {
+		return err
+	}
+
+	return db.
+		Model(model.Blob{}).
+		Where("key = ?", key).
+		Update("deleting_at", 0).
+		Error
+}
+
+// blobClaimed reports if a blob's object is being deleted. Claims older than
+// blobDeleteTimeout were given up by a crashed process and are ignored
+func blobClaimed(b *model.Blob) bool {
+	return b.DeletingAt != 0 && time.Since(time.Unix(b.DeletingAt, 0)) < blobDeleteTimeout
+}
+
+// AcquireBlob adds a reference to the blob behind a file or version key,
+// creating the blob row the first time. Keys that aren't content addressed
+// are ignored
+func AcquireBlob(tx *gorm.DB, key, sha string, size int64) error {
+	if !isBlobKey(key) {
+		return nil
+	}
+
+	return tx.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			// Rows created by claimBlob don't know the content yet
+			DoUpdates: clause.Assignments(map[string]any{
+				"ref_count": gorm.Expr("blobs.ref_count + 1"),
+				"sha256":    gorm.Expr("excluded.sha256"),
+				"size":      gorm.Expr("excluded.size"),
+			}),
+		}).
+		Create(&model.Blob{
+			Key:       key,
+			SHA256:    sha,
+			Size:      size,
+			RefCount:  1,
+			CreatedAt: time.Now().Unix(),
+		}).
+		Error
+}
+
+// HoldBlob adds a reference to a blob for an upload in progress and returns
+// how many references the blob has with it. Holding the blob before its
+// object is stored keeps the outbox and the GC from deleting the object
+// until the file pointing to it is saved. If the object is being deleted
+// HoldBlob waits for that to finish, the caller has to check it's stored.
+// The hold has to be dropped with ReleaseHold in the transaction that saves
+// the file or once the upload is given up
+func HoldBlob(db *gorm.DB, key, sha string, size int64) (int, error) {
+	if err := AcquireBlob(db, key, sha, size); err != nil {
+		return 0, err
+	}
+
+	for {
+		var blob model.Blob
+		if err := db.Where("key = ?", key).First(&blob).Error; err != nil {
+			return 0, err
+		}
+
+		if !blobClaimed(&blob) {
+			return blob.RefCount, nil
+		}
+
+		time.Sleep(blobClaimPoll)
+	}
+}
+
+// ReleaseHold drops the reference HoldBlob took. The object is queued for
+// deletion if nothing references it anymore
+func ReleaseHold(tx *gorm.DB, key string) error {
+	if !isBlobKey(key) {
+		return nil
+	}
+
+	unused, err := ReleaseBlobs(tx, []string{key})
+	if err != nil {
+		return err
+	}
+
+	return EnqueueDeletes(tx, unused)
+}
+
+// ReleaseBlobs drops one reference for every occurrence of a key and
+// returns the keys whose objects can be deleted once the transaction
+// commits. Blobs are only returned when nothing references them anymore,
+// every other key is returned as is
+func ReleaseBlobs(tx *gorm.DB, keys []string) ([]string, error) {
+	refs := map[string]int{}
+	deletable := []string{}
+
+	for _, k := range keys {
+		if isBlobKey(k) {
+			refs[k]++
+		} else {
+			deletable = append(deletable, k)
+		}
+	}
+
+	if len(refs) == 0 {
+		return compactKeys(deletable), nil
+	}
+
+	blobs := make([]string, 0, len(refs))
+	for k, n := range refs {
+		err := tx.
+			Model(model.Blob{}).
+			Where("key = ?", k).
+			Update("ref_count", gorm.Expr("ref_count - ?", n)).
+			Error
+		if err != nil {
+			return nil, err
+		}
+
+		blobs = append(blobs, k)
+	}
+
+	var unused []string
+	err := tx.
+		Model(model.Blob{}).
+		Where("key IN ? AND ref_count <= 0", blobs).
+		Pluck("key", &unused).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(unused) > 0 {
+		// Claimed rows are dropped by whoever is deleting the object
+		err := tx.
+			Where("key IN ? AND deleting_at = 0", unused).
+			Delete(model.Blob{}).
+			Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return compactKeys(append(deletable, unused...)), nil
+}
+
+// DiscardKeys deletes objects nothing in the database points to and returns
+// the keys that were deleted. Blobs that were referenced or held since are
+// kept
+func (u *Uploader) DiscardKeys(ctx context.Context, keys []string) ([]string, error) {
+	deleted := make([]string, 0, len(keys))
+
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+
+		failed, err := u.deleteUnused(ctx, keys[start:end])
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, k := range keys[start:end] {
+			if msg, ok := failed[k]; ok {
+				zap.L().Error("Failed to delete object", zap.String("key", k), zap.String("message", msg))
+				continue
+			}
+
+			deleted = append(deleted, k)
+		}
+	}
+
+	return deleted, nil
+}
+
+// deleteUnused deletes at most 1000 objects and returns the error message of
+// every key that couldn't be deleted. Blobs are claimed for the deletion and
+// skipped when they're referenced or held, a new upload with the same
+// content could have stored them again since their deletion was recorded.
+// Skipped keys count as deleted
+func (u *Uploader) deleteUnused(ctx context.Context, keys []string) (map[string]string, error) {
+	claimed := []string{}
+	discard := []string{}
+
+	defer func() {
+		for _, k := range claimed {
+			if err := releaseBlob(u.DB, k); err != nil {
+				zap.L().Error("Failed to release blob", zap.String("key", k), zap.Error(err))
+			}
+		}
+	}()
+
+	for _, k := range keys {
+		if isBlobKey(k) {
+			ok, err := claimBlob(u.DB, k)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			claimed = append(claimed, k)
+		}
+
+		discard = append(discard, k)
+	}
+
+	// Uploads wait on the claims so the deletion can't take longer than
+	// they consider a claim alive
+	ctx, cancel := context.WithTimeout(ctx, blobDeleteTimeout)
+	defer cancel()
+
+	return u.deleteObjects(ctx, discard)
+}
+
+// Abandon cleans up after an upload that won't be saved. The hold on its
+// blob is dropped and the thumbnail is queued for deletion
+func (u *Uploader) Abandon(file *model.File) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ReleaseHold(tx, file.FileKey); err != nil {
+			return err
+		}
+
+		keys := []string{}
+		if file.ThumbKey != "" {
+			keys = append(keys, file.ThumbKey)
+		}
+
+		return EnqueueDeletes(tx, keys)
+	})
+}
+
+func compactKeys(keys []string) []string {
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	fingerprintFrames = 16
+	frameHashWidth    = 9 // dHash compares every pixel with its right neighbour
+	frameHashHeight   = 8
+
+	// Average amount of differing bits per frame for two videos to still
+	// count as similar
+	FingerprintMaxDistance = 10
+
+	// Every pair of fingerprints is compared so libraries bigger than this
+	// only have their newest files grouped by similarity
+	maxSimilarFiles = 2000
+)
+
+// HashFile returns the hex encoded SHA-256 of a local file
+func HashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file, %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash file, %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DuplicatesOf returns the IDs of a user's files with the provided content
+// hash, trashed and expired files excluded
+func DuplicatesOf(db *gorm.DB, userID, sha string) ([]uint, error) {
+	ids := []uint{}
+
+	err := db.
+		Model(model.File{}).
+		Where("user_id = ? AND sha256 = ?", userID, sha).
+		Scopes(NotExpired).
+		Pluck("id", &ids).
+		Error
+
+	return ids, err
+}
+
+// MakeFingerprint samples frames evenly from the input and returns the
+// hex encoded dHash of every one of them. Unlike the SHA-256 it survives
+// re-encodes, resizes and small edits
+func MakeFingerprint(input string, duration float64, j *JobQueue, userID string) (string, error) {
+	if duration <= 0 {
+		return "", fmt.Errorf("invalid duration %f", duration)
+	}
+
+	rawPath := path.Join(os.TempDir(), util.RandStr(10)+".gray")
+	defer os.Remove(rawPath)
+
+	args := []string{
+		"-y", "-loglevel", "error",
+		"-i", input,
+		"-vf", fmt.Sprintf("fps=%f,scale=%d:%d,format=gray", fingerprintFrames/duration, frameHashWidth, frameHashHeight),
+		"-frames:v", fmt.Sprint(fingerprintFrames),
+		"-f", "rawvideo",
+		rawPath,
+	}
+
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := j.Enqueue(&FFmpegJob{
+		ID:         util.RandStr(5),
+		UserID:     userID,
+		Args:       &args,
+		Ctx:        ctx,
+		Done:       done,
+		Background: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return "", err
+		}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	raw, err := os.ReadFile(rawPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read sampled frames, %w", err)
+	}
+
+	frameSize := frameHashWidth * frameHashHeight
+	if len(raw) < frameSize {
+		return "", fmt.Errorf("no frames sampled")
+	}
+
+	hashes := make([]byte, 0, len(raw)/frameSize*8)
+	for start := 0; start+frameSize <= len(raw); start += frameSize {
+		hashes = binary.BigEndian.AppendUint64(hashes, frameHash(raw[start:start+frameSize]))
+	}
+
+	return hex.EncodeToString(hashes), nil
+}
+
+// frameHash returns the dHash of a 9x8 grayscale frame
+func frameHash(frame []byte) uint64 {
+	var h uint64
+
+	for y := range frameHashHeight {
+		row := frame[y*frameHashWidth : (y+1)*frameHashWidth]
+
+		for x := range frameHashWidth - 1 {
+			h <<= 1
+			if row[x] > row[x+1] {
+				h |= 1
+			}
+		}
+	}
+
+	return h
+}
+
+// FingerprintDistance returns the average amount of differing bits per
+// frame of two fingerprints or -1 if they can't be compared
+func FingerprintDistance(a, b string) int {
+	return frameDistance(decodeFingerprint(a), decodeFingerprint(b))
+}
+
+// decodeFingerprint returns the frame hashes of a fingerprint or nil if it
+// isn't valid hex
+func decodeFingerprint(fp string) []uint64 {
+	raw, err := hex.DecodeString(fp)
+	if err != nil {
+		return nil
+	}
+
+	hashes := make([]uint64, len(raw)/8)
+	for i := range hashes {
+		hashes[i] = binary.BigEndian.Uint64(raw[i*8:])
+	}
+
+	return hashes
+}
+
+// frameDistance works like FingerprintDistance on decoded fingerprints
+func frameDistance(a, b []uint64) int {
+	frames := min(len(a), len(b))
+	if frames == 0 {
+		return -1
+	}
+
+	total := 0
+	for i := range frames {
+		total += bits.OnesCount64(a[i] ^ b[i])
+	}
+
+	return total / frames
+}
+
+func makeFileFingerprint(db *gorm.DB, u *Uploader, file *model.File) error {
+	fp, err := MakeFingerprint(cdnURL(file), file.Duration, u.JobQueue, file.UserID)
+	if err != nil {
+		return err
+	}
+
+	res := db.
+		Model(model.File{}).
+		Where("id = ? AND version = ?", file.ID, file.Version).
+		Update("fingerprint", fp)
+	if res.Error != nil {
+		return fmt.Errorf("failed to save fingerprint, %w", res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		zap.L().Debug("File changed while fingerprinting, discarding the fingerprint", zap.Uint("file_id", file.ID))
+		return nil
+	}
+
+	zap.L().Debug("Fingerprint stored", zap.Uint("file_id", file.ID))
+	return nil
+}
+
+// DuplicatePolicy returns what should happen when a user uploads a file
+// they have already
+func DuplicatePolicy(db *gorm.DB, userID string) (string, error) {
+	var policy string
+
+	err := db.
+		Model(model.User{}).
+		Where("id = ?", userID).
+		Select("duplicate_policy").
+		Scan(&policy).
+		Error
+
+	return policy, err
+}
+
+type DuplicateGroup struct {
+	Match string       `json:"match"` // exact for the same SHA-256, similar for close fingerprints
+	Files []model.File `json:"files"`
+}
+
+// FindDuplicates groups a user's files with the same content. Files with a
+// fingerprint are also grouped with files that look alike, those groups
+// are only returned if they aren't all exact copies of each other. Exact
+// copies are grouped by the database, only the newest maxSimilarFiles
+// fingerprints are compared with each other
+func FindDuplicates(db *gorm.DB, userID string) ([]DuplicateGroup, error) {
+	groups, err := exactDuplicates(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	similar, err := similarFiles(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(groups, similar...), nil
+}
+
+// exactDuplicates returns groups of files with the same SHA-256, oldest
+// files first
+func exactDuplicates(db *gorm.DB, userID string) ([]DuplicateGroup, error) {
+	shared := db.
+		Model(model.File{}).
+		Select("sha256").
+		Where("user_id = ? AND sha256 != ''", userID).
+		Scopes(NotExpired).
+		Group("sha256").
+		Having("COUNT(*) > 1")
+
+	var files []model.File
+
+	err := db.
+		Where("user_id = ? AND sha256 IN (?)", userID, shared).
+		Scopes(NotExpired).
+		Order("created_at asc, id asc").
+		Find(&files).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	bySHA := map[string][]model.File{}
+	order := []string{}
+	for _, f := range files {
+		if _, ok := bySHA[f.SHA256]; !ok {
+			order = append(order, f.SHA256)
+		}
+		bySHA[f.SHA256] = append(bySHA[f.SHA256], f)
+	}
+
+	groups := make([]DuplicateGroup, 0, len(order))
+	for _, sha := range order {
+		groups = append(groups, DuplicateGroup{Match: "exact", Files: bySHA[sha]})
+	}
+
+	return groups, nil
+}
+
+type fingerprintRow struct {
+	ID          uint
+	SHA256      string `gorm:"column:sha256"`
+	Fingerprint string
+}
+
+// similarFiles returns groups of files that look alike. Only the newest
+// maxSimilarFiles fingerprinted files are compared as every pair is
+func similarFiles(db *gorm.DB, userID string) ([]DuplicateGroup, error) {
+	var rows []fingerprintRow
+
+	err := db.
+		Model(model.File{}).
+		Select("id, sha256, fingerprint").
+		Where("user_id = ? AND sha256 != '' AND fingerprint != ''", userID).
+		Scopes(NotExpired).
+		Order("created_at desc, id desc").
+		Limit(maxSimilarFiles).
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(rows)
+
+	// Decoded once instead of for every pair
+	hashes := make([][]uint64, len(rows))
+	for i, r := range rows {
+		hashes[i] = decodeFingerprint(r.Fingerprint)
+	}
+
+	// Union-find over every pair of fingerprinted files
+	parent := make([]int, len(rows))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range rows {
+		for j := i + 1; j < len(rows); j++ {
+			if rows[i].SHA256 == rows[j].SHA256 {
+				continue
+			}
+
+			dist := frameDistance(hashes[i], hashes[j])
+			if dist >= 0 && dist <= FingerprintMaxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]uint{}
+	roots := []int{}
+	for i, r := range rows {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], r.ID)
+	}
+
+	ids := []uint{}
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			ids = append(ids, members[root]...)
+		}
+	}
+
+	if len(ids) == 0 {
+		return []DuplicateGroup{}, nil
+	}
+
+	var files []model.File
+	if err := db.Where("id IN ?", ids).Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]model.File, len(files))
+	for _, f := range files {
+		byID[f.ID] = f
+	}
+
+	groups := []DuplicateGroup{}
+	for _, root := range roots {
+		if len(members[root]) < 2 {
+			continue
+		}
+
+		g := DuplicateGroup{Match: "similar", Files: make([]model.File, 0, len(members[root]))}
+		for _, id := range members[root] {
+			if f, ok := byID[id]; ok {
+				g.Files = append(g.Files, f)
+			}
+		}
+
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	BackendSoftware = "software"
+	BackendNVENC    = "nvenc"
+	BackendQSV      = "qsv"
+	BackendVAAPI    = "vaapi"
+)
+
+const defaultVAAPIDevice = "/dev/dri/renderD128"
+
+// Encoder describes a video encoder that ffmpeg can use and
+// knows how to build the flags needed to drive it
+type Encoder struct {
+	Backend string // One of the Backend* constants
+	Name    string // Name of the ffmpeg encoder
+	Device  string // Render node, only used by VAAPI
+}
+
+// SoftwareEncoder is always available and used whenever hardware
+// encoding isn't possible
+var SoftwareEncoder = &Encoder{Backend: BackendSoftware, Name: "libx264"}
+
+func (e *Encoder) IsHardware() bool {
+	return e.Backend != BackendSoftware
+}
+
+// InputArgs returns the flags that have to be placed before the input
+// so the hardware device is initialized
+func (e *Encoder) InputArgs() []string {
+	switch e.Backend {
+	case BackendNVENC:
+		return []string{"-hwaccel", "cuda"}
+	case BackendQSV:
+		return []string{"-init_hw_device", "qsv=hw", "-filter_hw_device", "hw"}
+	case BackendVAAPI:
+		return []string{"-init_hw_device", "vaapi=va:" + e.Device, "-filter_hw_device", "va"}
+	}
+
+	return nil
+}
+
+// DecodeArgs returns the flags used to only accelerate decoding. Used for
+// jobs that provide their own arguments
+func (e *Encoder) DecodeArgs() []string {
+	switch e.Backend {
+	case BackendNVENC:
+		return []string{"-hwaccel", "cuda"}
+	case BackendQSV:
+		return []string{"-hwaccel", "qsv"}
+	case BackendVAAPI:
+		return []string{"-hwaccel", "vaapi", "-hwaccel_device", e.Device}
+	}
+
+	return nil
+}
+
+// UploadFilters returns the filters that have to end the video filter
+// chain so frames are moved to GPU memory before encoding
+func (e *Encoder) UploadFilters() []string {
+	switch e.Backend {
+	case BackendQSV:
+		return []string{"format=nv12", "hwupload=extra_hw_frames=64"}
+	case BackendVAAPI:
+		return []string{"format=nv12", "hwupload"}
+	}
+
+	return nil
+}
+
+// QualityArgs returns rate control flags for visually lossless exports
+func (e *Encoder) QualityArgs() []string {
+	switch e.Backend {
+	case BackendNVENC:
+		return []string{"-preset", "p7", "-rc", "vbr", "-cq", "19", "-b:v", "0"}
+	case BackendQSV:
+		return []string{"-preset", "veryslow", "-global_quality", "18"}
+	case BackendVAAPI:
+		return []string{"-rc_mode", "CQP", "-qp", "18"}
+	}
+
+	return []string{"-preset", "slow", "-crf", "18", "-pix_fmt", "yuv420p"}
+}
+
+// BitrateArgs returns rate control flags that keep the video stream
+// at the provided bitrate
+func (e *Encoder) BitrateArgs(kbps float64) []string {
+	rate := fmt.Sprintf("%.0fK", kbps)
+	bufSize := fmt.Sprintf("%dk", int(kbps*2))
+
+	switch e.Backend {
+	case BackendNVENC:
+		return []string{"-rc", "cbr", "-b:v", rate, "-maxrate", rate, "-bufsize", bufSize}
+	case BackendVAAPI:
+		return []string{"-rc_mode", "CBR", "-b:v", rate, "-maxrate", rate, "-bufsize", bufSize}
+	}
+
+	return []string{"-b:v", rate, "-maxrate", rate, "-bufsize", bufSize}
+}
+
+// hwaccel returns the name of the hwaccel ffmpeg has to support
+// for the encoder to work
+func (e *Encoder) hwaccel() string {
+	switch e.Backend {
+	case BackendNVENC:
+		return "cuda"
+	case BackendQSV:
+		return "qsv"
+	case BackendVAAPI:
+		return "vaapi"
+	}
+
+	return ""
+}
+
+// candidateEncoders returns hardware encoders worth trying for a GPU
+// vendor, in order of preference
+func candidateEncoders(vendor, device string) []*Encoder {
+	if device == "" {
+		device = defaultVAAPIDevice
+	}
+
+	switch vendor {
+	case "nvidia":
+		return []*Encoder{{Backend: BackendNVENC, Name: "h264_nvenc"}}
+	case "intel":
+		return []*Encoder{
+			{Backend: BackendQSV, Name: "h264_qsv"},
+			{Backend: BackendVAAPI, Name: "h264_vaapi", Device: device},
+		}
+	case "amd":
+		return []*Encoder{{Backend: BackendVAAPI, Name: "h264_vaapi", Device: device}}
+	}
+
+	return nil
+}
+
+// ProbeEncoder finds the best working encoder. Every hardware candidate for
+// the GPU vendor has to be listed by the local ffmpeg build and successfully
+// encode a short test clip. Returns SoftwareEncoder if none of them work
+func ProbeEncoder(vendor, device string) *Encoder {
+	if vendor == "" {
+		return SoftwareEncoder
+	}
+
+	encoders, err := listFFmpegCapabilities("-encoders")
+	if err != nil {
+		zap.L().Warn("Failed to list ffmpeg encoders, using software encoding", zap.Error(err))
+		return SoftwareEncoder
+	}
+
+	hwaccels, err := listFFmpegCapabilities("-hwaccels")
+	if err != nil {
+		zap.L().Warn("Failed to list ffmpeg hwaccels, using software encoding", zap.Error(err))
+		return SoftwareEncoder
+	}
+
+	for _, enc := range candidateEncoders(vendor, device) {
+		if !slices.Contains(encoders, enc.Name) {
+			zap.L().Debug("Encoder not supported by ffmpeg build", zap.String("encoder", enc.Name))
+			continue
+		}
+
+		if !slices.Contains(hwaccels, enc.hwaccel()) {
+			zap.L().Debug("Hwaccel not supported by ffmpeg build", zap.String("hwaccel", enc.hwaccel()))
+			continue
+		}
+
+		if enc.Device != "" {
+			if _, err := os.Stat(enc.Device); err != nil {
+				zap.L().Debug("Render device not found", zap.String("device", enc.Device))
+				continue
+			}
+		}
+
+		if err := testEncode(enc); err != nil {
+			zap.L().Warn("Test encode failed", zap.String("encoder", enc.Name), zap.Error(err))
+			continue
+		}
+
+		zap.L().Info("Using hardware encoder", zap.String("encoder", enc.Name), zap.String("backend", enc.Backend))
+		return enc
+	}
+
+	zap.L().Warn("No working hardware encoder found, using software encoding", zap.String("vendor", vendor))
+	return SoftwareEncoder
+}
+
+// listFFmpegCapabilities runs ffmpeg -encoders or -hwaccels and returns the
+// names it lists
+func listFFmpegCapabilities(flag string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", flag).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg %s failed, %w", flag, err)
+	}
+
+	return parseFFmpegCapabilities(flag, out), nil
+}
+
+// parseFFmpegCapabilities parses the output of ffmpeg -encoders and -hwaccels
+// into a list of names
+func parseFFmpegCapabilities(flag string, out []byte) []string {
+	names := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+
+	// -encoders prints a legend that ends with a dashed line, -hwaccels
+	// prints a single header line
+	inList := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !inList {
+			if flag == "-encoders" {
+				inList = strings.HasPrefix(line, "---")
+			} else {
+				inList = strings.HasSuffix(line, ":")
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if flag == "-encoders" {
+			if len(fields) < 2 {
+				continue
+			}
+			names = append(names, fields[1])
+		} else {
+			names = append(names, fields[0])
+		}
+	}
+
+	return names
+}
+
+// testEncode encodes a tiny generated clip to make sure the encoder
+// actually works on this machine
+func testEncode(enc *Encoder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, enc.InputArgs()...)
+	args = append(args, "-f", "lavfi", "-i", "testsrc2=size=256x144:rate=30:duration=1")
+
+	if filters := enc.UploadFilters(); len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+
+	args = append(args, "-c:v", enc.Name, "-frames:v", "30", "-f", "null", "-")
+
+	var stdErr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stdErr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w (%s)", err, strings.TrimSpace(stdErr.String()))
+	}
+
+	return nil
+}
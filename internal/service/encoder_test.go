@@ -0,0 +1,144 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+var (
+	nvencEncoder = &Encoder{Backend: BackendNVENC, Name: "h264_nvenc"}
+	qsvEncoder   = &Encoder{Backend: BackendQSV, Name: "h264_qsv"}
+	vaapiEncoder = &Encoder{Backend: BackendVAAPI, Name: "h264_vaapi", Device: "/dev/dri/renderD129"}
+)
+
+func TestCandidateEncoders(t *testing.T) {
+	tests := []struct {
+		vendor string
+		device string
+		want   []Encoder
+	}{
+		{"nvidia", "", []Encoder{{Backend: BackendNVENC, Name: "h264_nvenc"}}},
+		{"intel", "", []Encoder{
+			{Backend: BackendQSV, Name: "h264_qsv"},
+			{Backend: BackendVAAPI, Name: "h264_vaapi", Device: defaultVAAPIDevice},
+		}},
+		{"intel", "/dev/dri/renderD129", []Encoder{
+			{Backend: BackendQSV, Name: "h264_qsv"},
+			{Backend: BackendVAAPI, Name: "h264_vaapi", Device: "/dev/dri/renderD129"},
+		}},
+		{"amd", "", []Encoder{{Backend: BackendVAAPI, Name: "h264_vaapi", Device: defaultVAAPIDevice}}},
+		{"", "", nil},
+		{"matrox", "", nil},
+	}
+
+	for _, tt := range tests {
+		got := []Encoder{}
+		for _, e := range candidateEncoders(tt.vendor, tt.device) {
+			got = append(got, *e)
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("candidateEncoders(%q, %q) = %+v, want %+v", tt.vendor, tt.device, got, tt.want)
+		}
+	}
+}
+
+func TestEncoderArgs(t *testing.T) {
+	tests := []struct {
+		enc     *Encoder
+		input   []string
+		decode  []string
+		upload  []string
+		quality []string
+		bitrate []string
+	}{
+		{
+			enc:     SoftwareEncoder,
+			quality: []string{"-preset", "slow", "-crf", "18", "-pix_fmt", "yuv420p"},
+			bitrate: []string{"-b:v", "1500K", "-maxrate", "1500K", "-bufsize", "3000k"},
+		},
+		{
+			enc:     nvencEncoder,
+			input:   []string{"-hwaccel", "cuda"},
+			decode:  []string{"-hwaccel", "cuda"},
+			quality: []string{"-preset", "p7", "-rc", "vbr", "-cq", "19", "-b:v", "0"},
+			bitrate: []string{"-rc", "cbr", "-b:v", "1500K", "-maxrate", "1500K", "-bufsize", "3000k"},
+		},
+		{
+			enc:     qsvEncoder,
+			input:   []string{"-init_hw_device", "qsv=hw", "-filter_hw_device", "hw"},
+			decode:  []string{"-hwaccel", "qsv"},
+			upload:  []string{"format=nv12", "hwupload=extra_hw_frames=64"},
+			quality: []string{"-preset", "veryslow", "-global_quality", "18"},
+			bitrate: []string{"-b:v", "1500K", "-maxrate", "1500K", "-bufsize", "3000k"},
+		},
+		{
+			enc:     vaapiEncoder,
+			input:   []string{"-init_hw_device", "vaapi=va:/dev/dri/renderD129", "-filter_hw_device", "va"},
+			decode:  []string{"-hwaccel", "vaapi", "-hwaccel_device", "/dev/dri/renderD129"},
+			upload:  []string{"format=nv12", "hwupload"},
+			quality: []string{"-rc_mode", "CQP", "-qp", "18"},
+			bitrate: []string{"-rc_mode", "CBR", "-b:v", "1500K", "-maxrate", "1500K", "-bufsize", "3000k"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.enc.Name, func(t *testing.T) {
+			check := func(name string, got, want []string) {
+				if !slices.Equal(got, want) {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+
+			check("InputArgs", tt.enc.InputArgs(), tt.input)
+			check("DecodeArgs", tt.enc.DecodeArgs(), tt.decode)
+			check("UploadFilters", tt.enc.UploadFilters(), tt.upload)
+			check("QualityArgs", tt.enc.QualityArgs(), tt.quality)
+			check("BitrateArgs", tt.enc.BitrateArgs(1500), tt.bitrate)
+		})
+	}
+}
+
+const ffmpegEncodersOutput = `Encoders:
+ V..... = Video
+ A..... = Audio
+ S..... = Subtitle
+ .F.... = Frame-level multithreading
+ ..S... = Slice-level multithreading
+ ...X.. = Codec is experimental
+ ....B. = Supports draw_horiz_band
+ .....D = Supports direct rendering method 1
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ V..... h264_vaapi           H.264/AVC (VAAPI) (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+ S..... mov_text             3GPP Timed Text subtitle
+`
+
+const ffmpegHwaccelsOutput = `Hardware acceleration methods:
+vdpau
+cuda
+vaapi
+
+`
+
+func TestParseFFmpegCapabilities(t *testing.T) {
+	tests := []struct {
+		flag string
+		out  string
+		want []string
+	}{
+		{"-encoders", ffmpegEncodersOutput, []string{"libx264", "h264_nvenc", "h264_vaapi", "aac", "mov_text"}},
+		{"-hwaccels", ffmpegHwaccelsOutput, []string{"vdpau", "cuda", "vaapi"}},
+		{"-hwaccels", "Hardware acceleration methods:\n", []string{}},
+		{"-encoders", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := parseFFmpegCapabilities(tt.flag, []byte(tt.out))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseFFmpegCapabilities(%q) = %q, want %q", tt.flag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// NotExpired is a scope that hides files whose expiry has passed but that
+// the reaper didn't get to yet
+func NotExpired(db *gorm.DB) *gorm.DB {
+	return db.Where("(files.expires_at IS NULL OR files.expires_at > ?)", time.Now().Unix())
+}
+
+// FileReaper periodically deletes expired files
+// and gives the storage they took up back to their owners
+func FileReaper(t time.Duration, db *gorm.DB) {
+	ticker := time.NewTicker(t)
+
+	zap.L().Debug("File reaper attached", zap.Duration("tick_every", t))
+
+	go func() {
+		for range ticker.C {
+			reaped, err := PurgeFiles(db, "expires_at IS NOT NULL AND expires_at <= ?", time.Now().Unix())
+			if err != nil {
+				zap.L().Error("Failed to reap expired files", zap.Error(err))
+			}
+
+			if reaped > 0 {
+				zap.L().Debug("File reaper finished", zap.Int("reaped", reaped))
+			}
+		}
+	}()
+}
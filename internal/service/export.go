@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bitwise74/video-api/pkg/validators"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Amount of times an export is made again with a smaller size
+// when it doesn't fit into MaxSize
+const maxExportAttempts = 3
+
+var ErrExportTooLarge = errors.New("export doesn't fit into the max size")
+
+// MakeAnimation exports part of a video as a GIF or an animated WebP. GIFs
+// use a palettegen/paletteuse two step pipeline. If the result is bigger
+// than MaxSize the width and frame rate are lowered and it's tried again
+func MakeAnimation(input, format string, o *validators.ExportOptions, j *JobQueue, userID string) (string, error) {
+	width, fps := o.Width, o.FPS
+
+	for attempt := range maxExportAttempts {
+		var out string
+		var err error
+
+		if format == "gif" {
+			out, err = makeGIF(input, o, width, fps, j, userID)
+		} else {
+			out, err = makeAnimatedWebP(input, o, width, fps, j, userID)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		stat, err := os.Stat(out)
+		if err != nil {
+			os.Remove(out)
+			return "", err
+		}
+
+		if o.MaxSize == 0 || float64(stat.Size()) <= o.MaxSize*1024*1024 {
+			return out, nil
+		}
+
+		os.Remove(out)
+
+		zap.L().Debug("Export too large, trying again smaller",
+			zap.Int("attempt", attempt),
+			zap.Int64("size", stat.Size()))
+
+		width = max(16, width*3/4/2*2)
+		fps = max(1, fps*3/4)
+	}
+
+	return "", ErrExportTooLarge
+}
+
+func makeGIF(input string, o *validators.ExportOptions, width, fps int, j *JobQueue, userID string) (string, error) {
+	base := fmt.Sprintf("fps=%d,scale=%d:-1:flags=lanczos", fps, width)
+
+	palettePath := path.Join(os.TempDir(), util.RandStr(10)+".png")
+	defer os.Remove(palettePath)
+
+	err := runExportJob(j, userID, []string{
+		"-y", "-loglevel", "error",
+		"-ss", util.FloatToTimestamp(o.Start),
+		"-t", util.FloatToTimestamp(o.End - o.Start),
+		"-i", input,
+		"-vf", base + ",palettegen=stats_mode=diff",
+		"-frames:v", "1",
+		palettePath,
+	})
+	if err != nil {
+		return "", fmt.Errorf("palettegen failed, %w", err)
+	}
+
+	out := path.Join(os.TempDir(), util.RandStr(10)+".gif")
+
+	err = runExportJob(j, userID, []string{
+		"-y", "-loglevel", "error",
+		"-ss", util.FloatToTimestamp(o.Start),
+		"-t", util.FloatToTimestamp(o.End - o.Start),
+		"-i", input,
+		"-i", palettePath,
+		"-lavfi", base + "[x];[x][1:v]paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle",
+		"-loop", "0",
+		out,
+	})
+	if err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("paletteuse failed, %w", err)
+	}
+
+	return out, nil
+}
+
+func makeAnimatedWebP(input string, o *validators.ExportOptions, width, fps int, j *JobQueue, userID string) (string, error) {
+	out := path.Join(os.TempDir(), util.RandStr(10)+".webp")
+
+	err := runExportJob(j, userID, []string{
+		"-y", "-loglevel", "error",
+		"-ss", util.FloatToTimestamp(o.Start),
+		"-t", util.FloatToTimestamp(o.End - o.Start),
+		"-i", input,
+		"-vf", fmt.Sprintf("fps=%d,scale=%d:-1:flags=lanczos", fps, width),
+		"-an",
+		"-c:v", "libwebp_anim",
+		"-q:v", "75",
+		"-loop", "0",
+		out,
+	})
+	if err != nil {
+		os.Remove(out)
+		return "", err
+	}
+
+	return out, nil
+}
+
+func runExportJob(j *JobQueue, userID string, args []string) error {
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	err := j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Args:   &args,
+		Ctx:    ctx,
+		Done:   done,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
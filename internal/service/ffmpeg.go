@@ -11,13 +11,18 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
+var ErrQueueFull = errors.New("job queue full")
+
 type FFmpegJob struct {
 	ID       string
 	UserID   string
@@ -28,6 +33,10 @@ type FFmpegJob struct {
 	Args     *[]string
 	Ctx      context.Context
 	Done     chan error
+
+	// Background jobs aren't started by the user so they don't
+	// report progress
+	Background bool
 }
 
 type FFMpegJobStats struct {
@@ -39,20 +48,43 @@ type JobQueue struct {
 	jobs    chan *FFmpegJob
 	running atomic.Int32
 	workers int64
+	Encoder *Encoder
+
+	// Used to read the concurrent job limit of a user's plan
+	db       *gorm.DB
+	mu       sync.Mutex
+	userJobs map[string]int // Queued or running jobs started by each user
+
+	// Runs a single ffmpeg invocation, runFFmpegJobWith outside of tests
+	runWith func(job *FFmpegJob, enc *Encoder) (int64, error)
 }
 
 // NewJobQueue initializes a new job queue that limits the
-// max amount of jobs that can be queued at once
-func NewJobQueue() *JobQueue {
+// max amount of jobs that can be queued at once. Up to FFMPEG_MAX_JOBS jobs
+// wait for a free worker, Enqueue only fails with ErrQueueFull once that
+// many are waiting. If GPU usage is enabled the available hardware encoders
+// are probed
+func NewJobQueue(db *gorm.DB) *JobQueue {
 	maxJobs, _ := strconv.ParseInt(os.Getenv("FFMPEG_MAX_JOBS"), 10, 32)
 	workers, _ := strconv.ParseInt(os.Getenv("FFMPEG_WORKERS"), 10, 32)
 
 	zap.L().Debug("Initializing job queue", zap.Int64("max_jobs", maxJobs))
 
-	return &JobQueue{
-		jobs:    make(chan *FFmpegJob),
-		workers: workers,
+	encoder := SoftwareEncoder
+	if useGPU, _ := strconv.ParseBool(os.Getenv("FFMPEG_USE_GPU")); useGPU {
+		encoder = ProbeEncoder(os.Getenv("FFMPEG_GPU_VENDOR"), os.Getenv("FFMPEG_VAAPI_DEVICE"))
 	}
+
+	q := &JobQueue{
+		jobs:     make(chan *FFmpegJob, maxJobs),
+		workers:  workers,
+		Encoder:  encoder,
+		db:       db,
+		userJobs: map[string]int{},
+	}
+	q.runWith = q.runFFmpegJobWith
+
+	return q
 }
 
 func (q *JobQueue) StartWorkerPool() {
@@ -65,12 +97,20 @@ func (q *JobQueue) worker() {
 	for job := range q.jobs {
 		err := q.runFFmpegJob(job)
 
+		// The slot is freed first so the caller can queue its next step
+		// right away
+		q.running.Add(-1)
+
+		if !job.Background {
+			q.release(job.UserID)
+		}
+
 		job.Done <- err
 		close(job.Done)
 
-		q.running.Add(-1)
-
-		ProgressMap.Delete(job.UserID)
+		if !job.Background {
+			ProgressMap.Delete(job.UserID)
+		}
 
 		if err != nil {
 			zap.L().Error("FFmpeg job finished with an error",
@@ -88,30 +128,90 @@ func (q *JobQueue) worker() {
 	}
 }
 
+// Enqueue adds a job to the queue. Jobs started by users count against the
+// concurrent job limit of their plan, background jobs don't
 func (q *JobQueue) Enqueue(job *FFmpegJob) error {
+	if !job.Background {
+		if err := q.reserve(job.UserID); err != nil {
+			return err
+		}
+	}
+
 	select {
 	case q.jobs <- job:
 		q.running.Add(1)
 		zap.L().Debug("New ffmpeg job enqueued", zap.Int32("enqueued", q.running.Load()), zap.String("user_id", job.UserID))
 		return nil
 	default:
-		return errors.New("job queue full")
+		if !job.Background {
+			q.release(job.UserID)
+		}
+
+		return ErrQueueFull
 	}
 }
 
-func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string) ([]string, float64, error) {
-	args := []string{}
+// reserve takes one of the concurrent job slots of a user's plan
+func (q *JobQueue) reserve(userID string) error {
+	plan, err := UserPlan(q.db, userID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch user plan, %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if plan.MaxConcurrentJobs > 0 && q.userJobs[userID] >= plan.MaxConcurrentJobs {
+		return ErrTooManyJobs
+	}
+
+	q.userJobs[userID]++
+	return nil
+}
+
+func (q *JobQueue) release(userID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
-	encoder := os.Getenv("FFMPEG_ENCODER")
-	if encoder == "" {
-		encoder = "libx264"
+	q.userJobs[userID]--
+	if q.userJobs[userID] <= 0 {
+		delete(q.userJobs, userID)
 	}
+}
+
+// MakeFFmpegFlags builds the arguments for a processing job using
+// the provided encoder
+func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string, enc *Encoder) ([]string, float64, error) {
+	args := []string{}
 
 	var duration float64
 	var err error
 
+	if !opts.AudioOnly {
+		args = append(args, enc.InputArgs()...)
+	}
+
 	args = append(args, "-i", p)
 
+	// Extra inputs have to come before the trim flags or they would apply to them
+	softSubs := opts.SubtitlePath != "" && opts.SubtitleMode == "soft"
+	nextInput := 1
+
+	subInput := 0
+	if softSubs {
+		args = append(args, "-i", opts.SubtitlePath)
+		subInput = nextInput
+		nextInput++
+	}
+
+	imageWatermark := opts.Watermark != nil && opts.Watermark.Type == "image"
+
+	wmInput := 0
+	if imageWatermark {
+		args = append(args, "-i", opts.WatermarkPath)
+		wmInput = nextInput
+	}
+
 	if opts.TrimStart > 0 {
 		args = append(args, "-ss", util.FloatToTimestamp(opts.TrimStart))
 	}
@@ -123,37 +223,58 @@ func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to run ffprobe to determine video duration: %w", err)
 		}
+
+		// Only the part after the trim start is encoded
+		if opts.TrimStart > 0 {
+			duration -= opts.TrimStart
+			if duration <= 0 {
+				return nil, 0, fmt.Errorf("trim start %.2fs is past the end of the video", opts.TrimStart)
+			}
+		}
 	}
 
-	args = append(args, "-c:v", encoder)
+	audioArgs, audioBitrate, err := makeAudioFlags(opts, p, duration)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	if opts.LosslessExport {
-		switch encoder {
-		case "libx264":
-			args = append(args, "preset", "slow", "-crf", "18", "-pix_fmt", "yuv420p")
-		case "h264_nvenc", "hevc_nvenc":
-			args = append(args, "-preset", "p7", "-rc", "vbr", "-cq", "19", "-b:v", "0")
-		default:
-			args = append(args, "-crf", "10")
+	// Streams are always mapped explicitly since extra inputs would
+	// otherwise be picked up by the automatic stream selection
+	if !opts.AudioOnly {
+		if graph := makeVideoFilterGraph(opts, enc, wmInput); graph != "" {
+			args = append(args, "-filter_complex", graph, "-map", "[vout]")
+		} else {
+			args = append(args, "-map", "0:v:0")
 		}
-	} else if opts.TargetSize > 0 {
-		totalKilobits := opts.TargetSize * 8388.608
-		totalBitrateKbps := totalKilobits / duration
-		videoBitrateKbps := totalBitrateKbps - 128
-		if videoBitrateKbps <= 0 {
-			videoBitrateKbps = 5
+
+		args = append(args, "-c:v", enc.Name)
+
+		if opts.LosslessExport {
+			args = append(args, enc.QualityArgs()...)
+		} else if opts.TargetSize > 0 {
+			videoBitrateKbps := targetBitrateKbps(opts.TargetSize, duration) - float64(audioBitrate)
+			if videoBitrateKbps <= 0 {
+				videoBitrateKbps = 5
+			}
+			args = append(args, enc.BitrateArgs(videoBitrateKbps)...)
+		}
+	}
+
+	if !opts.RemoveAudio {
+		args = append(args, "-map", fmt.Sprintf("0:a:%d?", opts.AudioTrack))
+	}
+
+	args = append(args, audioArgs...)
+
+	if softSubs {
+		args = append(args, "-map", fmt.Sprintf("%d:0", subInput), "-c:s", "mov_text")
+
+		if opts.SubtitleLanguage != "" {
+			args = append(args, "-metadata:s:s:0", "language="+opts.SubtitleLanguage)
 		}
-		videoBitrateStr := fmt.Sprintf("%.0fK", videoBitrateKbps)
-		bufSizeStr := fmt.Sprintf("%dk", int(videoBitrateKbps*2))
-		args = append(args,
-			"-b:v", videoBitrateStr,
-			"-maxrate", videoBitrateStr,
-			"-bufsize", bufSizeStr,
-		)
 	}
 
 	args = append(args,
-		"-c:a", "copy",
 		"-movflags", "+frag_keyframe+empty_moov+faststart",
 		"-loglevel", "error",
 	)
@@ -168,47 +289,138 @@ func (q *JobQueue) MakeFFmpegFlags(opts *validators.ProcessingOptions, p string)
 	return args, duration, nil
 }
 
-// The encoder is always appended
-func addHWAccelFlags(args []string) []string {
-	useGPU, _ := strconv.ParseBool(os.Getenv("FFMPEG_USE_GPU"))
-	hwaccel := os.Getenv("FFMPEG_HWACCEL")
+// makeVideoFilterGraph builds the filter graph of the main video stream.
+// It returns an empty string if the video doesn't need any filtering
+func makeVideoFilterGraph(opts *validators.ProcessingOptions, enc *Encoder, wmInput int) string {
+	filters := []string{}
 
-	if useGPU && hwaccel != "" {
-		for i, arg := range args {
-			if arg == "-i" && i > 0 {
-				args = append(args[:i], append([]string{"-hwaccel", hwaccel}, args[i:]...)...)
-				break
-			}
+	if opts.SubtitlePath != "" && opts.SubtitleMode == "burn" {
+		filters = append(filters, "subtitles=filename="+escapeFilterPath(opts.SubtitlePath))
+	}
+
+	// Text is drawn after the subtitles so it stays on top
+	if opts.Watermark != nil && opts.Watermark.Type == "text" {
+		filters = append(filters, drawTextFilter(opts.Watermark, opts.WatermarkPath))
+	}
+
+	// Uploading to the GPU has to be the last step
+	upload := enc.UploadFilters()
+
+	if opts.Watermark == nil || opts.Watermark.Type != "image" {
+		filters = append(filters, upload...)
+		if len(filters) == 0 {
+			return ""
 		}
+
+		return "[0:v]" + strings.Join(filters, ",") + "[vout]"
+	}
+
+	pre := "null"
+	if len(filters) > 0 {
+		pre = strings.Join(filters, ",")
+	}
+
+	wm := opts.Watermark
+	x, y := watermarkPosition(wm)
+
+	overlay := "overlay=" + x + ":" + y
+	if len(upload) > 0 {
+		overlay += "," + strings.Join(upload, ",")
+	}
+
+	return strings.Join([]string{
+		"[0:v]" + pre + "[pre]",
+		fmt.Sprintf("[%d:v]format=rgba,colorchannelmixer=aa=%.2f[wmraw]", wmInput, wm.Opacity),
+		fmt.Sprintf("[wmraw][pre]scale2ref=w=main_w*%.3f:h=ow/a[wm][base]", wm.Scale),
+		"[base][wm]" + overlay + "[vout]",
+	}, ";")
+}
+
+// escapeFilterPath escapes a path so it can be used as a filter option
+func escapeFilterPath(p string) string {
+	r := strings.NewReplacer(`\`, `\\`, `:`, `\:`, `'`, `\'`, `,`, `\,`, `[`, `\[`, `]`, `\]`, `;`, `\;`)
+	return r.Replace(p)
+}
+
+// targetBitrateKbps returns the total bitrate needed to fit a video of the
+// given duration into sizeMB megabytes
+func targetBitrateKbps(sizeMB, duration float64) float64 {
+	return sizeMB * 8388.608 / duration
+}
+
+// insertBeforeInput places flags right before the first input
+func insertBeforeInput(args, flags []string) []string {
+	i := slices.Index(args, "-i")
+	if i == -1 || len(flags) == 0 {
+		return args
 	}
 
-	return args
+	return slices.Concat(args[:i], flags, args[i:])
 }
 
+// runFFmpegJob runs the job on the hardware encoder if the job allows it.
+// A failed hardware encode is retried once with libx264 as long as the
+// output can still be rewound
 func (q *JobQueue) runFFmpegJob(job *FFmpegJob) error {
+	enc := SoftwareEncoder
+	if job.UseGPU && q.Encoder != nil {
+		enc = q.Encoder
+	}
+
+	written, err := q.runWith(job, enc)
+	if err == nil || !enc.IsHardware() || job.Ctx.Err() != nil {
+		return err
+	}
+
+	if written > 0 {
+		f, ok := job.Output.(*os.File)
+		if !ok {
+			return err
+		}
+
+		if err := f.Truncate(0); err != nil {
+			return fmt.Errorf("failed to rewind output for software retry, %w", err)
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind output for software retry, %w", err)
+		}
+	}
+
+	zap.L().Warn("Hardware encode failed, retrying with software encoder",
+		zap.String("encoder", enc.Name),
+		zap.String("job_id", job.ID),
+		zap.Error(err))
+
+	_, err = q.runWith(job, SoftwareEncoder)
+	return err
+}
+
+// runFFmpegJobWith runs a single ffmpeg invocation and returns the amount
+// of bytes written to the job output
+func (q *JobQueue) runFFmpegJobWith(job *FFmpegJob, enc *Encoder) (int64, error) {
 	var duration float64
 	var err error
+	var args []string
 
 	if job.Args == nil {
 		if job.Opts == nil {
-			return errors.New("no arguments provided")
+			return 0, errors.New("no arguments provided")
 		}
 
-		var args []string
-
-		args, duration, err = q.MakeFFmpegFlags(job.Opts, job.FilePath)
+		args, duration, err = q.MakeFFmpegFlags(job.Opts, job.FilePath, enc)
 		if err != nil {
-			return err
+			return 0, err
 		}
+	} else {
+		args = slices.Clone(*job.Args)
 
-		job.Args = &args
-	}
-
-	if job.UseGPU {
-		*job.Args = addHWAccelFlags(*job.Args)
+		if enc.IsHardware() {
+			args = insertBeforeInput(args, enc.DecodeArgs())
+		}
 	}
 
-	cmd := exec.CommandContext(job.Ctx, "ffmpeg", *job.Args...)
+	cmd := exec.CommandContext(job.Ctx, "ffmpeg", args...)
 
 	zap.L().Debug("Running FFmpeg command", zap.String("cmd", cmd.String()))
 
@@ -217,16 +429,24 @@ func (q *JobQueue) runFFmpegJob(job *FFmpegJob) error {
 
 	stderrBuf := &bytes.Buffer{}
 
+	storeProgress := func(p float64) {
+		if job.Background {
+			return
+		}
+
+		ProgressMap.Store(job.UserID, FFMpegJobStats{
+			JobID:    job.ID,
+			Progress: p,
+		})
+	}
+
 	go func() {
 		scanner := bufio.NewScanner(io.TeeReader(stderrPipe, stderrBuf))
 		for scanner.Scan() {
 			line := scanner.Text()
 
 			if line == "progress=end" {
-				ProgressMap.Store(job.UserID, FFMpegJobStats{
-					JobID:    job.ID,
-					Progress: 100.0,
-				})
+				storeProgress(100.0)
 				return
 			}
 
@@ -234,40 +454,38 @@ func (q *JobQueue) runFFmpegJob(job *FFmpegJob) error {
 				msStr := after
 				outTimeMs, err := strconv.ParseFloat(msStr, 64)
 				if err == nil {
-					percent := (outTimeMs / (duration * 1000)) / 10
-					ProgressMap.Store(job.UserID, FFMpegJobStats{
-						JobID:    job.ID,
-						Progress: percent,
-					})
+					storeProgress((outTimeMs / (duration * 1000)) / 10)
 				}
 			}
 		}
 
-		ProgressMap.Store(job.UserID, FFMpegJobStats{
-			JobID:    job.ID,
-			Progress: 100.0,
-		})
+		storeProgress(100.0)
 	}()
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %v", err)
+		return 0, fmt.Errorf("failed to create stdout pipe: %v", err)
 	}
 	defer stdout.Close()
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start ffmpeg, %w", err)
+		return 0, fmt.Errorf("failed to start ffmpeg, %w", err)
 	}
 
-	_, err = io.Copy(job.Output, stdout)
+	output := job.Output
+	if output == nil {
+		output = io.Discard
+	}
+
+	written, err := io.Copy(output, stdout)
 	if err != nil {
-		return fmt.Errorf("streaming error, %w", err)
+		return written, fmt.Errorf("streaming error, %w", err)
 	}
 
 	if err := cmd.Wait(); err != nil {
 		zap.L().Error("FFmpeg failed", zap.Error(err), zap.String("stderr", stderrBuf.String()))
-		return fmt.Errorf("ffmpeg failed: %w", err)
+		return written, fmt.Errorf("ffmpeg failed: %w", err)
 	}
 
-	return nil
+	return written, nil
 }
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestInsertBeforeInput(t *testing.T) {
+	tests := []struct {
+		args  []string
+		flags []string
+		want  []string
+	}{
+		{
+			[]string{"-y", "-i", "in.mp4", "out.mp4"},
+			[]string{"-hwaccel", "cuda"},
+			[]string{"-y", "-hwaccel", "cuda", "-i", "in.mp4", "out.mp4"},
+		},
+		{
+			[]string{"-i", "a.mp4", "-i", "b.png", "out.mp4"},
+			[]string{"-hwaccel", "qsv"},
+			[]string{"-hwaccel", "qsv", "-i", "a.mp4", "-i", "b.png", "out.mp4"},
+		},
+		{[]string{"-y", "-i", "in.mp4"}, nil, []string{"-y", "-i", "in.mp4"}},
+		{[]string{"-f", "lavfi"}, []string{"-hwaccel", "cuda"}, []string{"-f", "lavfi"}},
+	}
+
+	for _, tt := range tests {
+		got := insertBeforeInput(slices.Clone(tt.args), tt.flags)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("insertBeforeInput(%q, %q) = %q, want %q", tt.args, tt.flags, got, tt.want)
+		}
+	}
+}
+
+// fakeRun records the encoders a job ran with. The hardware run writes
+// partial output before failing, the software run writes "sw"
+type fakeRun struct {
+	used    []string
+	swErr   error
+	partial bool
+}
+
+func (f *fakeRun) run(job *FFmpegJob, enc *Encoder) (int64, error) {
+	f.used = append(f.used, enc.Name)
+
+	if enc.IsHardware() {
+		if !f.partial {
+			return 0, errors.New("hardware encode failed")
+		}
+
+		n, _ := io.WriteString(job.Output, "partial hw output")
+		return int64(n), errors.New("hardware encode failed")
+	}
+
+	if f.swErr != nil {
+		return 0, f.swErr
+	}
+
+	n, _ := io.WriteString(job.Output, "sw")
+	return int64(n), nil
+}
+
+func TestRunFFmpegJobRetry(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		encoder *Encoder
+		useGPU  bool
+		ctx     context.Context
+		output  func(t *testing.T) io.Writer
+		fake    fakeRun
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "software only",
+			encoder: nvencEncoder,
+			want:    []string{"libx264"},
+		},
+		{
+			name:    "hardware retried",
+			encoder: nvencEncoder,
+			useGPU:  true,
+			want:    []string{"h264_nvenc", "libx264"},
+		},
+		{
+			name:    "software failure isn't retried",
+			encoder: SoftwareEncoder,
+			useGPU:  true,
+			fake:    fakeRun{swErr: errors.New("software encode failed")},
+			want:    []string{"libx264"},
+			wantErr: true,
+		},
+		{
+			name:    "retry failure",
+			encoder: vaapiEncoder,
+			useGPU:  true,
+			fake:    fakeRun{swErr: errors.New("software encode failed")},
+			want:    []string{"h264_vaapi", "libx264"},
+			wantErr: true,
+		},
+		{
+			name:    "cancelled job",
+			encoder: qsvEncoder,
+			useGPU:  true,
+			ctx:     cancelled,
+			want:    []string{"h264_qsv"},
+			wantErr: true,
+		},
+		{
+			name:    "streamed output can't be rewound",
+			encoder: nvencEncoder,
+			useGPU:  true,
+			fake:    fakeRun{partial: true},
+			want:    []string{"h264_nvenc"},
+			wantErr: true,
+		},
+		{
+			name:    "file output is rewound",
+			encoder: nvencEncoder,
+			useGPU:  true,
+			output: func(t *testing.T) io.Writer {
+				f, err := os.CreateTemp(t.TempDir(), "out-*.mp4")
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { f.Close() })
+				return f
+			},
+			fake: fakeRun{partial: true},
+			want: []string{"h264_nvenc", "libx264"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			var output io.Writer = &bytes.Buffer{}
+			if tt.output != nil {
+				output = tt.output(t)
+			}
+
+			fake := tt.fake
+			q := &JobQueue{Encoder: tt.encoder, runWith: fake.run}
+
+			err := q.runFFmpegJob(&FFmpegJob{ID: "test", UseGPU: tt.useGPU, Ctx: ctx, Output: output})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runFFmpegJob() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(fake.used, tt.want) {
+				t.Errorf("ran with %q, want %q", fake.used, tt.want)
+			}
+
+			if f, ok := output.(*os.File); ok && !tt.wantErr {
+				b, err := os.ReadFile(f.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(b) != "sw" {
+					t.Errorf("output is %q, want only the software output", b)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Files purged in one transaction
+const purgeBatchSize = 500
+
+// DeleteFileRows removes files along with their subtitles, versions, tags
+// and collection entries. It returns the keys of every S3 object that belonged
+// to them and nothing else uses, and the amount of storage they took up.
+// Objects should only be deleted once the transaction commits
+func DeleteFileRows(tx *gorm.DB, files []model.File) ([]string, int64, error) {
+	if len(files) == 0 {
+		return nil, 0, nil
+	}
+
+	ids := make([]uint, len(files))
+	keys := []string{}
+
+	for i, f := range files {
+		ids[i] = f.ID
+		keys = append(keys, f.ObjectKeys()...)
+	}
+
+	var subtitleKeys []string
+	err := tx.
+		Model(model.Subtitle{}).
+		Where("file_id IN ?", ids).
+		Pluck("key", &subtitleKeys).
+		Error
+	if err != nil {
+		return nil, 0, err
+	}
+	keys = append(keys, subtitleKeys...)
+
+	var versions []model.FileVersion
+	err = tx.
+		Where("file_id IN ?", ids).
+		Find(&versions).
+		Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Every retained version counts against the storage, the current one
+	// included. Files that were never edited only have their own size
+	versioned := map[uint]int64{}
+	for _, v := range versions {
+		versioned[v.FileID] += v.Size
+		keys = append(keys, v.ObjectKeys()...)
+	}
+
+	var freed int64
+	for _, f := range files {
+		if size, ok := versioned[f.ID]; ok {
+			freed += size
+		} else {
+			freed += f.Size
+		}
+	}
+
+	if err := tx.Where("file_id IN ?", ids).Delete(model.Subtitle{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("file_id IN ?", ids).Delete(model.FileVersion{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("file_id IN ?", ids).Delete(model.CollectionFile{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("file_id IN ?", ids).Delete(model.FileTag{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("id IN ?", ids).Delete(model.File{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Every row held its own blob reference, the current version shares its
+	// objects with the file so other keys show up twice
+	keys, err = ReleaseBlobs(tx, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return keys, freed, nil
+}
+
+// PurgeFiles permanently deletes every file matching the condition in
+// batches, trashed files included. The storage they took up is given back to
+// their owners and their objects are deleted by the outbox worker. Returns
+// how many files were purged. Files are selected and locked in the purging
+// transaction so the condition still holds when they're deleted, a file
+// restored meanwhile is kept
+func PurgeFiles(db *gorm.DB, query string, args ...any) (int, error) {
+	purged := 0
+
+	for {
+		var files []model.File
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.
+				Unscoped().
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where(query, args...).
+				Limit(purgeBatchSize).
+				Find(&files).
+				Error
+			if err != nil {
+				return err
+			}
+
+			byUser := map[string][]model.File{}
+			for _, f := range files {
+				byUser[f.UserID] = append(byUser[f.UserID], f)
+			}
+
+			for userID, userFiles := range byUser {
+				keys, freed, err := DeleteFileRows(tx, userFiles)
+				if err != nil {
+					return err
+				}
+
+				if err := EnqueueDeletes(tx, keys); err != nil {
+					return err
+				}
+
+				err = tx.
+					Model(model.Stats{}).
+					Where("user_id = ?", userID).
+					Updates(map[string]any{
+						"used_storage":   gorm.Expr("used_storage - ?", freed),
+						"uploaded_files": gorm.Expr("uploaded_files - ?", len(userFiles)),
+					}).
+					Error
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+
+		purged += len(files)
+
+		if len(files) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultGCGrace = 24 // In hours
+
+	// Orphaned keys listed in a report, the counts include every one of them
+	gcReportKeys = 1000
+)
+
+// GCReport sums up what a garbage collection found in the bucket
+type GCReport struct {
+	DryRun        bool     `json:"dry_run"`
+	Scanned       int      `json:"scanned"`
+	Referenced    int      `json:"referenced"`
+	Recent        int      `json:"recent"` // Unreferenced but still within the grace period
+	Orphaned      int      `json:"orphaned"`
+	OrphanedBytes int64    `json:"orphaned_bytes"`
+	Deleted       int      `json:"deleted"`
+	DeadBlobs     int64    `json:"dead_blobs"` // Blob rows nothing references anymore
+	Keys          []string `json:"keys"`
+}
+
+// Every column that holds the key of a stored object
+var objectKeyColumns = []struct {
+	model  any
+	column string
+}{
+	{model.File{}, "file_key"},
+	{model.File{}, "thumb_key"},
+	{model.File{}, "sprite_key"},
+	{model.File{}, "sprite_vtt_key"},
+	{model.File{}, "preview_key"},
+	{model.FileVersion{}, "file_key"},
+	{model.FileVersion{}, "thumb_key"},
+	{model.Subtitle{}, "key"},
+	{model.Watermark{}, "image_key"},
+}
+
+// GCGrace returns how old an unreferenced object has to be before it's
+// collected, set with GC_GRACE_HOURS. Uploads only get their row once the
+// objects are stored so the grace period has to outlast the slowest one
+func GCGrace() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("GC_GRACE_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = defaultGCGrace
+	}
+
+	return time.Hour * time.Duration(hours)
+}
+
+// knownKeys returns the key of every object the database references,
+// trashed files included
+func knownKeys(db *gorm.DB) (map[string]struct{}, error) {
+	known := map[string]struct{}{}
+
+	for _, c := range objectKeyColumns {
+		var keys []string
+
+		err := db.
+			Unscoped().
+			Model(c.model).
+			Where(c.column+" != ''").
+			Pluck(c.column, &keys).
+			Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s keys, %w", c.column, err)
+		}
+
+		for _, k := range keys {
+			known[k] = struct{}{}
+		}
+	}
+
+	return known, nil
+}
+
+// CollectGarbage deletes objects in the bucket that nothing in the database
+// references and that are older than the grace period. Blob rows without
+// references are dropped first so their objects are collected too, unless
+// they're claimed for a deletion in progress. A dry run only reports what
+// would be deleted
+func CollectGarbage(db *gorm.DB, u *Uploader, grace time.Duration, dryRun bool) (*GCReport, error) {
+	report := &GCReport{DryRun: dryRun, Keys: []string{}}
+
+	dead := db.
+		Model(model.Blob{}).
+		Where("ref_count <= 0 AND deleting_at < ?", time.Now().Add(-blobDeleteTimeout).Unix())
+
+	if dryRun {
+		if err := dead.Count(&report.DeadBlobs).Error; err != nil {
+			return report, err
+		}
+	} else {
+		res := dead.Delete(model.Blob{})
+		if res.Error != nil {
+			return report, res.Error
+		}
+
+		report.DeadBlobs = res.RowsAffected
+	}
+
+	known, err := knownKeys(db)
+	if err != nil {
+		return report, err
+	}
+
+	var live []string
+	err = db.
+		Model(model.Blob{}).
+		Where("ref_count > 0").
+		Pluck("key", &live).
+		Error
+	if err != nil {
+		return report, err
+	}
+
+	for _, k := range live {
+		known[k] = struct{}{}
+	}
+
+	cutoff := time.Now().Add(-grace)
+	orphans := []string{}
+
+	pages := s3.NewListObjectsV2Paginator(u.S3.C, &s3.ListObjectsV2Input{
+		Bucket: u.S3.Bucket,
+	})
+
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(context.Background())
+		if err != nil {
+			return report, fmt.Errorf("failed to list bucket, %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			report.Scanned++
+
+			if _, ok := known[key]; ok {
+				report.Referenced++
+				continue
+			}
+
+			if obj.LastModified != nil && obj.LastModified.After(cutoff) {
+				report.Recent++
+				continue
+			}
+
+			report.Orphaned++
+			report.OrphanedBytes += aws.ToInt64(obj.Size)
+			orphans = append(orphans, key)
+
+			if len(report.Keys) < gcReportKeys {
+				report.Keys = append(report.Keys, key)
+			}
+		}
+	}
+
+	if dryRun || len(orphans) == 0 {
+		return report, nil
+	}
+
+	// Blobs are checked once more in case an upload picked one up meanwhile
+	// Keys that were skipped or failed aren't counted
+	deleted, err := u.DiscardKeys(context.Background(), orphans)
+	report.Deleted = len(deleted)
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// ObjectGC periodically deletes orphaned objects from the bucket
+func ObjectGC(t time.Duration, db *gorm.DB, u *Uploader) {
+	ticker := time.NewTicker(t)
+
+	zap.L().Debug("Object GC attached", zap.Duration("tick_every", t))
+
+	go func() {
+		for range ticker.C {
+			report, err := CollectGarbage(db, u, GCGrace(), false)
+			if err != nil {
+				zap.L().Error("Failed to collect orphaned objects", zap.Error(err))
+				continue
+			}
+
+			zap.L().Debug("Object GC finished",
+				zap.Int("scanned", report.Scanned),
+				zap.Int("deleted", report.Deleted),
+				zap.Int64("freed", report.OrphanedBytes),
+				zap.Int64("dead_blobs", report.DeadBlobs))
+		}
+	}()
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// maxFolderDepth caps how deep folders can be nested so walking up the
+// tree always ends
+const maxFolderDepth = 32
+
+var (
+	ErrFolderCycle    = errors.New("a folder can't be moved into itself")
+	ErrFolderTooDeep  = errors.New("folders can be nested at most 32 levels deep")
+	ErrFolderNotOwned = errors.New("folder not found")
+)
+
+// CheckFolder makes sure the user owns the folder. Ownership is checked the
+// same way FileOwns checks files so a folder of another user looks like a
+// missing one
+func CheckFolder(db *gorm.DB, userID string, id uint) error {
+	var owns bool
+
+	err := db.
+		Model(model.Folder{}).
+		Where("id = ? AND user_id = ?", id, userID).
+		Select("count(*) > 0").
+		Find(&owns).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if !owns {
+		return ErrFolderNotOwned
+	}
+
+	return nil
+}
+
+// CheckFolderParent makes sure folder can be placed inside parent without
+// creating a cycle or nesting too deep. A zero folder is a new folder
+func CheckFolderParent(db *gorm.DB, userID string, folder, parent uint) error {
+	if err := CheckFolder(db, userID, parent); err != nil {
+		return err
+	}
+
+	current := &parent
+	for depth := 0; current != nil; depth++ {
+		if *current == folder {
+			return ErrFolderCycle
+		}
+
+		if depth >= maxFolderDepth {
+			return ErrFolderTooDeep
+		}
+
+		var f model.Folder
+		err := db.
+			Where("id = ? AND user_id = ?", *current, userID).
+			Select("parent_id").
+			First(&f).
+			Error
+		if err != nil {
+			return err
+		}
+
+		current = f.ParentID
+	}
+
+	return nil
+}
+
+// OwnedFileIDs filters ids down to the files the user owns
+func OwnedFileIDs(db *gorm.DB, userID string, ids []uint) ([]uint, error) {
+	var owned []uint
+
+	err := db.
+		Model(model.File{}).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Scopes(NotExpired).
+		Pluck("id", &owned).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return owned, nil
+}
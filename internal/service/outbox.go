@@ -0,0 +1,169 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	outboxBatchSize  = 1000 // Same as the most keys S3 deletes in one request
+	outboxBaseDelay  = 5 * time.Second
+	outboxMaxDelay   = time.Hour
+	outboxDoneMaxAge = 7 * 24 * time.Hour // Done ops are kept this long for debugging
+)
+
+// EnqueueDeletes records the deletion of objects in the outbox. It has to run
+// in the transaction that drops the rows pointing to them
+func EnqueueDeletes(tx *gorm.DB, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+
+	ops := make([]model.StorageOp, len(keys))
+	for i, k := range keys {
+		ops[i] = model.StorageOp{
+			Op:            "delete",
+			Key:           k,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+	}
+
+	return tx.CreateInBatches(ops, 100).Error
+}
+
+// outboxBackoff returns how long to wait before an op is retried
+func outboxBackoff(attempts int) time.Duration {
+	delay := outboxBaseDelay
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= outboxMaxDelay {
+			return outboxMaxDelay
+		}
+	}
+
+	return delay
+}
+
+// DrainOutbox performs every op that is due and returns how many succeeded.
+// Failed ops are retried later with exponential backoff
+func DrainOutbox(db *gorm.DB, u *Uploader) (int, error) {
+	done := 0
+
+	for {
+		var ops []model.StorageOp
+
+		err := db.
+			Where("done_at IS NULL AND next_attempt_at <= ?", time.Now().Unix()).
+			Order("id").
+			Limit(outboxBatchSize).
+			Find(&ops).
+			Error
+		if err != nil {
+			return done, err
+		}
+
+		if len(ops) == 0 {
+			return done, nil
+		}
+
+		keys := make([]string, 0, len(ops))
+		for _, op := range ops {
+			keys = append(keys, op.Key)
+		}
+
+		failed, err := u.deleteUnused(context.Background(), compactKeys(keys))
+		if err != nil {
+			if failed == nil {
+				failed = map[string]string{}
+			}
+
+			// Nothing is known about single keys so the whole batch is retried
+			for _, op := range ops {
+				failed[op.Key] = err.Error()
+			}
+		}
+
+		now := time.Now()
+		doneIDs := []uint{}
+
+		for _, op := range ops {
+			msg, ok := failed[op.Key]
+			if !ok {
+				doneIDs = append(doneIDs, op.ID)
+				continue
+			}
+
+			op.Attempts++
+
+			err := db.
+				Model(&op).
+				Updates(map[string]any{
+					"attempts":        op.Attempts,
+					"last_error":      msg,
+					"next_attempt_at": now.Add(outboxBackoff(op.Attempts)).Unix(),
+				}).
+				Error
+			if err != nil {
+				return done, err
+			}
+
+			zap.L().Warn("Storage op failed, retrying later",
+				zap.String("key", op.Key),
+				zap.Int("attempts", op.Attempts),
+				zap.String("error", msg))
+		}
+
+		if len(doneIDs) > 0 {
+			err := db.
+				Model(model.StorageOp{}).
+				Where("id IN ?", doneIDs).
+				Update("done_at", now.Unix()).
+				Error
+			if err != nil {
+				return done, err
+			}
+
+			done += len(doneIDs)
+		}
+
+		if len(ops) < outboxBatchSize {
+			return done, nil
+		}
+	}
+}
+
+// OutboxWorker periodically performs the storage ops recorded in the outbox
+// and drops the ones that were done a while ago
+func OutboxWorker(t time.Duration, db *gorm.DB, u *Uploader) {
+	ticker := time.NewTicker(t)
+
+	zap.L().Debug("Outbox worker attached", zap.Duration("tick_every", t))
+
+	go func() {
+		for range ticker.C {
+			done, err := DrainOutbox(db, u)
+			if err != nil {
+				zap.L().Error("Failed to drain storage outbox", zap.Error(err))
+			}
+
+			if done > 0 {
+				zap.L().Debug("Storage ops done", zap.Int("done", done))
+			}
+
+			err = db.
+				Where("done_at IS NOT NULL AND done_at <= ?", time.Now().Add(-outboxDoneMaxAge).Unix()).
+				Delete(model.StorageOp{}).
+				Error
+			if err != nil {
+				zap.L().Error("Failed to drop done storage ops", zap.Error(err))
+			}
+		}
+	}()
+}
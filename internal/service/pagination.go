@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is the envelope every list endpoint responds with. Counting every
+// matching row is as slow as offset pagination so the total is only sent
+// with the first page, clients keep it while paging
+type Page[T any] struct {
+	Items         []T    `json:"items"`
+	NextCursor    string `json:"next_cursor"`              // Empty on the last page
+	TotalEstimate *int64 `json:"total_estimate,omitempty"` // Matching rows when the first page was fetched, may drift while paging
+}
+
+// Sort describes a keyset sort order. Rows are ordered by Column and then by
+// ID so rows with the same key still have a stable order. Key returns the
+// values of both for the last row of a page
+type Sort[T any] struct {
+	Name   string
+	Column string
+	ID     string
+	Desc   bool
+	Key    func(*T) (any, uint)
+}
+
+// Cursor points right after the last row of a page. It's handed to clients
+// base64 encoded so they treat it as opaque
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	ID    uint   `json:"i"`
+}
+
+// EncodeCursor encodes a cursor for the response
+func EncodeCursor(c *Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor decodes a cursor sent by a client. An empty string is the
+// first page and returns nil. Cursors made for another sort order are
+// rejected because their value means something else
+func DecodeCursor(s, sort string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var c Cursor
+	if err := dec.Decode(&c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	// Numbers are kept as json.Number until here so big integer keys
+	// don't lose precision as float64
+	switch v := c.Value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			c.Value = i
+		} else if f, err := v.Float64(); err == nil {
+			c.Value = f
+		} else {
+			return nil, ErrInvalidCursor
+		}
+	case string:
+	default:
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// Paginate fetches the page after cursor from a filtered but unordered query.
+// One extra row is fetched to know if there's a next page. Matching rows are
+// only counted for the first page
+func Paginate[T any](q *gorm.DB, s *Sort[T], cursor *Cursor, limit int) (*Page[T], error) {
+	page := &Page[T]{Items: []T{}}
+
+	if cursor == nil {
+		var total int64
+
+		err := q.Session(&gorm.Session{NewDB: true}).
+			Table("(?) AS counted", q).
+			Count(&total).
+			Error
+		if err != nil {
+			return nil, err
+		}
+
+		page.TotalEstimate = &total
+	}
+
+	dir, cmp := "asc", ">"
+	if s.Desc {
+		dir, cmp = "desc", "<"
+	}
+
+	if cursor != nil {
+		q = q.Where(
+			"("+s.Column+" "+cmp+" ? OR ("+s.Column+" = ? AND "+s.ID+" "+cmp+" ?))",
+			cursor.Value, cursor.Value, cursor.ID,
+		)
+	}
+
+	err := q.
+		Order(s.Column + " " + dir).
+		Order(s.ID + " " + dir).
+		Limit(limit + 1).
+		Find(&page.Items).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+
+		v, id := s.Key(&page.Items[limit-1])
+		page.NextCursor = EncodeCursor(&Cursor{Sort: s.Name, Value: v, ID: id})
+	}
+
+	return page, nil
+}
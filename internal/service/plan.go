@@ -0,0 +1,89 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrTooManyJobs = errors.New("too many jobs for the user's plan")
+
+// PlanFromEnv builds the plan every user had before plans existed
+func PlanFromEnv() *model.Plan {
+	maxStorage, _ := strconv.ParseInt(os.Getenv("STORAGE_MAX_USAGE"), 10, 64)
+	maxUploadSize, _ := strconv.ParseInt(os.Getenv("UPLOAD_MAX_SIZE"), 10, 64)
+
+	return &model.Plan{
+		Name:          "default",
+		MaxStorage:    maxStorage,
+		MaxUploadSize: maxUploadSize,
+		OutputFormats: model.StringSlice{},
+		IsDefault:     true,
+		CreatedAt:     time.Now().Unix(),
+	}
+}
+
+// DefaultPlan returns the plan new users get
+func DefaultPlan(db *gorm.DB) (*model.Plan, error) {
+	var plan model.Plan
+
+	err := db.
+		Where("is_default = ?", true).
+		First(&plan).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+// UserPlan returns the plan of a user. Users without one get the default plan
+func UserPlan(db *gorm.DB, userID string) (*model.Plan, error) {
+	var plan model.Plan
+
+	err := db.
+		Joins("JOIN users ON users.plan_id = plans.id").
+		Where("users.id = ?", userID).
+		First(&plan).
+		Error
+	if err == gorm.ErrRecordNotFound {
+		return DefaultPlan(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+// AssignPlan moves users to a plan and gives them its storage limit
+func AssignPlan(tx *gorm.DB, plan *model.Plan, userIDs []string) error {
+	err := tx.
+		Model(model.User{}).
+		Where("id IN ?", userIDs).
+		Update("plan_id", plan.ID).
+		Error
+	if err != nil {
+		return err
+	}
+
+	return tx.
+		Model(model.Stats{}).
+		Where("user_id IN ?", userIDs).
+		Update("max_storage", plan.MaxStorage).
+		Error
+}
+
+// SyncPlanStorage copies the storage limit of a plan to every user on it
+func SyncPlanStorage(tx *gorm.DB, plan *model.Plan) error {
+	return tx.
+		Model(model.Stats{}).
+		Where("user_id IN (?)", tx.Model(model.User{}).Select("id").Where("plan_id = ?", plan.ID)).
+		Update("max_storage", plan.MaxStorage).
+		Error
+}
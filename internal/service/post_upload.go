@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PostUpload runs the optional jobs for a file that was just stored or
+// edited. The jobs run in the background and save their results on the
+// file once they're done, unless the file got another version meanwhile.
+// Objects of discarded results are left to the GC
+func PostUpload(db *gorm.DB, u *Uploader, file model.File) {
+	if os.Getenv("SPRITES_ENABLE") == "true" {
+		go func() {
+			if err := makeFileSprites(db, u, &file); err != nil {
+				zap.L().Error("Failed to create sprites for file", zap.Uint("file_id", file.ID), zap.Error(err))
+			}
+		}()
+	}
+
+	if os.Getenv("DUPLICATES_FINGERPRINT") == "true" {
+		go func() {
+			if err := makeFileFingerprint(db, u, &file); err != nil {
+				zap.L().Error("Failed to fingerprint file", zap.Uint("file_id", file.ID), zap.Error(err))
+			}
+		}()
+	}
+
+	if os.Getenv("PREVIEWS_ENABLE") == "true" {
+		go func() {
+			if err := makeFilePreview(db, u, &file); err != nil {
+				zap.L().Error("Failed to create preview for file", zap.Uint("file_id", file.ID), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// KeyPrefix returns the key derived objects of a file are stored under. The
+// video can be a blob shared with other files so the thumbnail key is used
+func KeyPrefix(f *model.File) string {
+	return strings.TrimSuffix(f.ThumbKey, path.Ext(f.ThumbKey))
+}
+
+// cdnURL returns the versioned CDN URL of the file's video
+func cdnURL(f *model.File) string {
+	return os.Getenv("CLOUDFRONT_URL") + "/" + f.FileKey + "?v=" + strconv.Itoa(f.Version)
+}
+
+func makeFileSprites(db *gorm.DB, u *Uploader, file *model.File) error {
+	spriteKey := KeyPrefix(file) + "_sprite.webp"
+	vttKey := KeyPrefix(file) + "_sprite.vtt"
+
+	// The version keeps players from using a cached sheet after an edit
+	spriteName := path.Base(spriteKey) + "?v=" + strconv.Itoa(file.Version)
+
+	spritePath, vttPath, err := MakeSprites(cdnURL(file), file.Duration, spriteName, SpriteOptsFromEnv(), u.JobQueue, file.UserID)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spritePath)
+	defer os.Remove(vttPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := u.PutFile(ctx, spritePath, spriteKey, "image/webp"); err != nil {
+		return err
+	}
+
+	if err := u.PutFile(ctx, vttPath, vttKey, "text/vtt"); err != nil {
+		return err
+	}
+
+	res := db.
+		Model(model.File{}).
+		Where("id = ? AND version = ?", file.ID, file.Version).
+		Updates(map[string]any{
+			"sprite_key":     spriteKey,
+			"sprite_vtt_key": vttKey,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("failed to save sprite keys, %w", res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		zap.L().Debug("File changed while making sprites, discarding them", zap.Uint("file_id", file.ID))
+		return nil
+	}
+
+	zap.L().Debug("Sprites stored", zap.Uint("file_id", file.ID))
+	return nil
+}
+
+func makeFilePreview(db *gorm.DB, u *Uploader, file *model.File) error {
+	previewKey := KeyPrefix(file) + "_preview.mp4"
+
+	previewPath, err := MakePreview(cdnURL(file), file.Duration, PreviewOptsFromEnv(), u.JobQueue, file.UserID)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(previewPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := u.PutFile(ctx, previewPath, previewKey, "video/mp4"); err != nil {
+		return err
+	}
+
+	res := db.
+		Model(model.File{}).
+		Where("id = ? AND version = ?", file.ID, file.Version).
+		Update("preview_key", previewKey)
+	if res.Error != nil {
+		return fmt.Errorf("failed to save preview key, %w", res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		zap.L().Debug("File changed while making the preview, discarding it", zap.Uint("file_id", file.ID))
+		return nil
+	}
+
+	zap.L().Debug("Preview stored", zap.Uint("file_id", file.ID))
+	return nil
+}
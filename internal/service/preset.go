@@ -0,0 +1,30 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// LoadPreset decodes the options of a user's preset into opts. Returns
+// gorm.ErrRecordNotFound if the user doesn't own the preset
+func LoadPreset(db *gorm.DB, userID string, id uint, opts *validators.ProcessingOptions) error {
+	var preset model.Preset
+
+	err := db.
+		Where("user_id = ? AND id = ?", userID, id).
+		First(&preset).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(preset.Options, opts); err != nil {
+		return fmt.Errorf("failed to decode preset options, %w", err)
+	}
+
+	return nil
+}
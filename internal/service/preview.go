@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type PreviewOpts struct {
+	Segments      int
+	SegmentLength float64 // In seconds
+	Width         int
+}
+
+// PreviewOptsFromEnv reads the preview settings validated in config.Setup
+func PreviewOptsFromEnv() *PreviewOpts {
+	segments, _ := strconv.Atoi(os.Getenv("PREVIEWS_SEGMENTS"))
+	length, _ := strconv.ParseFloat(os.Getenv("PREVIEWS_SEGMENT_LENGTH"), 64)
+	width, _ := strconv.Atoi(os.Getenv("PREVIEWS_WIDTH"))
+
+	return &PreviewOpts{
+		Segments:      segments,
+		SegmentLength: length,
+		Width:         width,
+	}
+}
+
+// previewSegments returns the start of every segment. Segments are
+// centered in equal parts of the video. Short videos get a single segment
+func previewSegments(duration float64, o *PreviewOpts) []float64 {
+	if duration <= float64(o.Segments)*o.SegmentLength {
+		return []float64{0}
+	}
+
+	part := duration / float64(o.Segments)
+	starts := make([]float64, o.Segments)
+
+	for i := range starts {
+		starts[i] = float64(i)*part + (part-o.SegmentLength)/2
+	}
+
+	return starts
+}
+
+// MakePreview creates a short muted clip out of evenly spaced segments of
+// the input. Every segment is a separate seeked input so only the needed
+// parts of remote inputs are downloaded
+func MakePreview(input string, duration float64, o *PreviewOpts, j *JobQueue, userID string) (string, error) {
+	if duration <= 0 {
+		return "", fmt.Errorf("invalid duration %f", duration)
+	}
+
+	starts := previewSegments(duration, o)
+	length := o.SegmentLength
+	if len(starts) == 1 {
+		length = min(duration, float64(o.Segments)*o.SegmentLength)
+	}
+
+	args := []string{"-y", "-loglevel", "error"}
+	filters := []string{}
+	labels := ""
+
+	for i, start := range starts {
+		args = append(args,
+			"-ss", util.FloatToTimestamp(start),
+			"-t", util.FloatToTimestamp(length),
+			"-i", input,
+		)
+
+		filters = append(filters, fmt.Sprintf("[%d:v]fps=24,scale=%d:-2,setpts=PTS-STARTPTS[v%d]", i, o.Width, i))
+		labels += fmt.Sprintf("[v%d]", i)
+	}
+
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[out]", labels, len(starts)))
+
+	previewPath := path.Join(os.TempDir(), util.RandStr(10)+".mp4")
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", "[out]",
+		"-an",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "28",
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		previewPath,
+	)
+
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := j.Enqueue(&FFmpegJob{
+		ID:         util.RandStr(5),
+		UserID:     userID,
+		Args:       &args,
+		Ctx:        ctx,
+		Done:       done,
+		Background: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			os.Remove(previewPath)
+			return "", err
+		}
+	case <-ctx.Done():
+		os.Remove(previewPath)
+		return "", ctx.Err()
+	}
+
+	zap.L().Debug("Created preview clip", zap.Int("segments", len(starts)))
+	return previewPath, nil
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReconcileReport sums up what a reconciliation found and fixed
+type ReconcileReport struct {
+	Users          int `json:"users"`           // Stats rows checked
+	FixedUsers     int `json:"fixed_users"`     // Stats rows that were off
+	Objects        int `json:"objects"`         // Video objects whose size was checked in S3
+	FixedObjects   int `json:"fixed_objects"`   // Objects whose stored size was off
+	MissingObjects int `json:"missing_objects"` // Objects the database points to that S3 doesn't have
+}
+
+type userUsage struct {
+	UsedStorage   int64
+	UploadedFiles int
+}
+
+// ReconcileStats recomputes the storage usage and the file count of every
+// user from the files and versions they have, trashed files included. With
+// verify the stored sizes of video objects are first compared with S3 so
+// the recomputed usage is based on what's really stored
+func ReconcileStats(db *gorm.DB, u *Uploader, verify bool) (*ReconcileReport, error) {
+	report := &ReconcileReport{}
+
+	if verify {
+		if err := verifyObjectSizes(db, u, report); err != nil {
+			return report, err
+		}
+	}
+
+	var userIDs []string
+	err := db.
+		Model(model.Stats{}).
+		Order("user_id").
+		Pluck("user_id", &userIDs).
+		Error
+	if err != nil {
+		return report, err
+	}
+
+	for _, userID := range userIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Uploads and deletes update the row while they add or drop
+			// files so it's locked until the usage is written back. Their
+			// changes are either counted by the sum or applied after it
+			var stats model.Stats
+			err := tx.
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ?", userID).
+				First(&stats).
+				Error
+			if err != nil {
+				return err
+			}
+
+			// Mirrors what DeleteFileRows gives back, every retained version
+			// or the file itself if it was never edited
+			var usage userUsage
+			err = tx.
+				Unscoped().
+				Model(model.File{}).
+				Where("user_id = ?", userID).
+				Select("COALESCE(SUM(COALESCE((SELECT SUM(file_versions.size) FROM file_versions WHERE file_versions.file_id = files.id), files.size)), 0) AS used_storage, COUNT(*) AS uploaded_files").
+				Scan(&usage).
+				Error
+			if err != nil {
+				return err
+			}
+
+			report.Users++
+
+			if usage.UsedStorage == stats.UsedStorage && usage.UploadedFiles == stats.UploadedFiles {
+				return nil
+			}
+
+			zap.L().Warn("Stats drifted from stored files",
+				zap.String("user_id", userID),
+				zap.Int64("used_storage", stats.UsedStorage),
+				zap.Int64("expected_used_storage", usage.UsedStorage),
+				zap.Int("uploaded_files", stats.UploadedFiles),
+				zap.Int("expected_uploaded_files", usage.UploadedFiles))
+
+			report.FixedUsers++
+
+			return tx.
+				Model(model.Stats{}).
+				Where("user_id = ?", userID).
+				Updates(map[string]any{
+					"used_storage":   usage.UsedStorage,
+					"uploaded_files": usage.UploadedFiles,
+				}).
+				Error
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// verifyObjectSizes compares the size of every distinct video object with the
+// sizes stored for it and fixes the rows that are off
+func verifyObjectSizes(db *gorm.DB, u *Uploader, report *ReconcileReport) error {
+	var keys []string
+
+	err := db.
+		Raw("SELECT file_key FROM files UNION SELECT file_key FROM file_versions").
+		Scan(&keys).
+		Error
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		size, err := u.ObjectSize(ctx, key)
+		cancel()
+
+		report.Objects++
+
+		if err != nil {
+			var notFound *types.NotFound
+			if errors.As(err, &notFound) {
+				report.MissingObjects++
+				zap.L().Warn("Stored object is missing", zap.String("key", key))
+				continue
+			}
+
+			return err
+		}
+
+		stale, err := fixObjectSize(db, key, size)
+		if err != nil {
+			return err
+		}
+
+		if stale > 0 {
+			report.FixedObjects++
+			zap.L().Warn("Stored size differs from the object", zap.String("key", key), zap.Int64("size", size), zap.Int64("rows", stale))
+		}
+	}
+
+	return nil
+}
+
+// fixObjectSize sets the size of every row that points to an object and
+// returns how many of them were off
+func fixObjectSize(db *gorm.DB, key string, size int64) (int64, error) {
+	var stale int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.
+			Unscoped().
+			Model(model.File{}).
+			Where("file_key = ? AND size != ?", key, size).
+			Update("size", size)
+		if res.Error != nil {
+			return res.Error
+		}
+		stale += res.RowsAffected
+
+		res = tx.
+			Model(model.FileVersion{}).
+			Where("file_key = ? AND size != ?", key, size).
+			Update("size", size)
+		if res.Error != nil {
+			return res.Error
+		}
+		stale += res.RowsAffected
+
+		return tx.
+			Model(model.Blob{}).
+			Where("key = ? AND size != ?", key, size).
+			Update("size", size).
+			Error
+	})
+
+	return stale, err
+}
+
+// StatsReconciler periodically recomputes the stats of every user. Object
+// sizes are checked with S3 too if STATS_RECONCILE_VERIFY_OBJECTS is set
+func StatsReconciler(t time.Duration, db *gorm.DB, u *Uploader) {
+	ticker := time.NewTicker(t)
+
+	zap.L().Debug("Stats reconciler attached", zap.Duration("tick_every", t))
+
+	go func() {
+		for range ticker.C {
+			verify, _ := strconv.ParseBool(os.Getenv("STATS_RECONCILE_VERIFY_OBJECTS"))
+
+			report, err := ReconcileStats(db, u, verify)
+			if err != nil {
+				zap.L().Error("Failed to reconcile stats", zap.Error(err))
+				continue
+			}
+
+			zap.L().Debug("Stats reconciliation finished",
+				zap.Int("users", report.Users),
+				zap.Int("fixed_users", report.FixedUsers),
+				zap.Int("fixed_objects", report.FixedObjects),
+				zap.Int("missing_objects", report.MissingObjects))
+		}
+	}()
+}
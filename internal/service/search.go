@@ -0,0 +1,188 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// searchDocument selects the indexed columns of the files matched by the
+// condition that follows it
+const searchDocument = `
+SELECT f.id, f.original_name,
+	COALESCE((SELECT group_concat(t.name, ' ') FROM file_tags ft JOIN tags t ON t.id = ft.tag_id WHERE ft.file_id = f.id), ''),
+	COALESCE(f.description, ''),
+	COALESCE((SELECT group_concat(s.text, ' ') FROM subtitles s WHERE s.file_id = f.id), '')
+FROM files f WHERE `
+
+// The triggers rebuild the document of a file whenever anything it's made
+// of changes, so every code path keeps the index in sync
+var searchTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS files_fts_insert AFTER INSERT ON files BEGIN
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id = NEW.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS files_fts_update AFTER UPDATE OF original_name, description ON files BEGIN
+		DELETE FROM files_fts WHERE rowid = OLD.id;
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id = NEW.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS files_fts_delete AFTER DELETE ON files BEGIN
+		DELETE FROM files_fts WHERE rowid = OLD.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS file_tags_fts_insert AFTER INSERT ON file_tags BEGIN
+		DELETE FROM files_fts WHERE rowid = NEW.file_id;
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id = NEW.file_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS file_tags_fts_delete AFTER DELETE ON file_tags BEGIN
+		DELETE FROM files_fts WHERE rowid = OLD.file_id;
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id = OLD.file_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS tags_fts_update AFTER UPDATE OF name ON tags BEGIN
+		DELETE FROM files_fts WHERE rowid IN (SELECT file_id FROM file_tags WHERE tag_id = NEW.id);
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id IN (SELECT file_id FROM file_tags WHERE tag_id = NEW.id);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS subtitles_fts_insert AFTER INSERT ON subtitles BEGIN
+		DELETE FROM files_fts WHERE rowid = NEW.file_id;
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id = NEW.file_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS subtitles_fts_delete AFTER DELETE ON subtitles BEGIN
+		DELETE FROM files_fts WHERE rowid = OLD.file_id;
+		INSERT INTO files_fts (rowid, name, tags, description, subtitles)` + searchDocument + `f.id = OLD.file_id;
+	END`,
+}
+
+// SetupSearch creates the FTS5 index of files along with the triggers that
+// keep it in sync and fills it the first time. FTS5 is only available when
+// built with the sqlite_fts5 tag so false is returned if it's missing and
+// searches should fall back to plain LIKE queries. PostgreSQL builds the
+// document of every file at query time so there's nothing to set up
+func SetupSearch(db *gorm.DB) bool {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return true
+	case "sqlite":
+	default:
+		return false
+	}
+
+	exists := db.Migrator().HasTable("files_fts")
+
+	err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS files_fts USING fts5(
+		name, tags, description, subtitles,
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`).Error
+	if err != nil {
+		zap.L().Warn("Full-text search unavailable, falling back to simple search", zap.Error(err))
+		return false
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, t := range searchTriggers {
+			if err := tx.Exec(t).Error; err != nil {
+				return err
+			}
+		}
+
+		// Stored in the index so the rank column can be used in keyset
+		// cursors. Name matches are weighted the highest
+		err := tx.Exec("INSERT INTO files_fts (files_fts, rank) VALUES ('rank', 'bm25(10.0, 5.0, 2.0, 1.0)')").Error
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+
+		return tx.Exec("INSERT INTO files_fts (rowid, name, tags, description, subtitles)" + searchDocument + "1 = 1").Error
+	})
+	if err != nil {
+		zap.L().Error("Failed to set up full-text search", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// MatchQuery turns user input into an FTS5 query. Every word has to match
+// and is treated as a prefix so results show up while typing. Words are
+// quoted so FTS5 syntax in the input is never interpreted
+func MatchQuery(input string) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"*`
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// tsQuery turns user input into a PostgreSQL tsquery with the same rules as
+// MatchQuery. Only letters and numbers are kept so operators in the input
+// are never interpreted
+func tsQuery(input string) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = w + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// pgSearch matches the files of a user against a tsquery and ranks them with
+// the same weights as the FTS5 index. Ranks are negated so lower is better
+// on both engines
+const pgSearch = `
+SELECT d.id, d.document, d.query, -ts_rank(d.vector, d.query) AS rank FROM (
+	SELECT f.id, q.query,
+		concat_ws(' ', f.original_name, tags.text, f.description, subs.text) AS document,
+		setweight(to_tsvector('simple', f.original_name), 'A') ||
+		setweight(to_tsvector('simple', COALESCE(tags.text, '')), 'B') ||
+		setweight(to_tsvector('simple', COALESCE(f.description, '')), 'C') ||
+		setweight(to_tsvector('simple', COALESCE(subs.text, '')), 'D') AS vector
+	FROM files f
+	CROSS JOIN to_tsquery('simple', ?) AS q(query)
+	LEFT JOIN LATERAL (SELECT string_agg(t.name, ' ') AS text FROM file_tags ft JOIN tags t ON t.id = ft.tag_id WHERE ft.file_id = f.id) tags ON true
+	LEFT JOIN LATERAL (SELECT string_agg(s.text, ' ') AS text FROM subtitles s WHERE s.file_id = f.id) subs ON true
+	WHERE f.user_id = ?
+) d
+WHERE d.vector @@ d.query`
+
+// MatchFiles narrows a query of a user's files down to the ones matching the
+// input and selects their snippet and rank. Both engines join the matches
+// as files_fts so sorts can use files_fts.rank
+func MatchFiles(q *gorm.DB, userID, input string) *gorm.DB {
+	if q.Dialector.Name() == "postgres" {
+		return q.
+			Select("files.*, ts_headline('simple', files_fts.document, files_fts.query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=1, MaxWords=12, MinWords=4') AS snippet, files_fts.rank AS rank").
+			Joins("JOIN ("+pgSearch+") AS files_fts ON files_fts.id = files.id", tsQuery(input), userID)
+	}
+
+	return q.
+		Select("files.*, snippet(files_fts, -1, '<mark>', '</mark>', '…', 12) AS snippet, files_fts.rank AS rank").
+		Joins("JOIN files_fts ON files_fts.rowid = files.id").
+		Where("files_fts MATCH ?", MatchQuery(input))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// LikeFiles narrows a files query down to the ones whose name, tags,
+// description or subtitles contain the input. It's used when full-text
+// search is unavailable or the input has no words
+func LikeFiles(q *gorm.DB, input string) *gorm.DB {
+	like := "%" + likeEscaper.Replace(strings.ToLower(input)) + "%"
+
+	return q.Where(`(LOWER(files.original_name) LIKE ? ESCAPE '\'
+		OR LOWER(files.description) LIKE ? ESCAPE '\'
+		OR EXISTS (SELECT 1 FROM file_tags ft JOIN tags t ON t.id = ft.tag_id WHERE ft.file_id = files.id AND LOWER(t.name) LIKE ? ESCAPE '\')
+		OR EXISTS (SELECT 1 FROM subtitles s WHERE s.file_id = files.id AND LOWER(s.text) LIKE ? ESCAPE '\'))`,
+		like, like, like, like)
+}
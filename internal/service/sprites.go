@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bitwise74/video-api/pkg/util"
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Upper bound of tiles in a single sprite sheet. Longer videos get
+// a bigger interval instead
+const maxSpriteTiles = 200
+
+// Largest width or height of a WebP image
+const maxWebPDimension = 16383
+
+type SpriteOpts struct {
+	Interval  float64 // Seconds between tiles
+	TileWidth int
+	Columns   int
+}
+
+// SpriteOptsFromEnv reads the sprite settings validated in config.Setup
+func SpriteOptsFromEnv() *SpriteOpts {
+	interval, _ := strconv.ParseFloat(os.Getenv("SPRITES_INTERVAL"), 64)
+	tileWidth, _ := strconv.Atoi(os.Getenv("SPRITES_TILE_WIDTH"))
+	columns, _ := strconv.Atoi(os.Getenv("SPRITES_COLUMNS"))
+
+	return &SpriteOpts{
+		Interval:  interval,
+		TileWidth: tileWidth,
+		Columns:   columns,
+	}
+}
+
+// GetVideoSize returns the dimensions of the first video stream
+func GetVideoSize(p string) (w, h int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "v:0", "-show_entries", "stream=width,height", "-of", "csv=s=x:p=0", "-i", p)
+
+	var stdOut, stdErr bytes.Buffer
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+
+	if err := cmd.Run(); err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed, %w (%s)", err, stdErr.String())
+	}
+
+	_, err = fmt.Sscanf(strings.TrimSpace(stdOut.String()), "%dx%d", &w, &h)
+	if err != nil || w == 0 || h == 0 {
+		return 0, 0, fmt.Errorf("malformed video size (%s)", stdOut.String())
+	}
+
+	return w, h, nil
+}
+
+type spriteLayout struct {
+	interval   float64
+	tiles      int
+	columns    int
+	rows       int
+	tileHeight int
+}
+
+// makeSpriteLayout places the tiles of a video on a sheet that fits in a
+// WebP image. The interval is raised when the tiles wouldn't fit
+func makeSpriteLayout(duration float64, w, h int, o *SpriteOpts) (*spriteLayout, error) {
+	// Same rounding as scale=W:-2
+	tileHeight := int(math.Round(float64(o.TileWidth)*float64(h)/float64(w)/2)) * 2
+
+	columns := min(o.Columns, maxWebPDimension/o.TileWidth)
+	maxTiles := min(maxSpriteTiles, columns*(maxWebPDimension/tileHeight))
+	if maxTiles == 0 {
+		return nil, fmt.Errorf("sprite tiles of %dx%d don't fit in a sprite sheet", o.TileWidth, tileHeight)
+	}
+
+	interval := o.Interval
+	if duration/interval > float64(maxTiles) {
+		interval = duration / float64(maxTiles)
+	}
+
+	tiles := min(int(math.Ceil(duration/interval)), maxTiles)
+	columns = min(columns, tiles)
+
+	return &spriteLayout{
+		interval:   interval,
+		tiles:      tiles,
+		columns:    columns,
+		rows:       int(math.Ceil(float64(tiles) / float64(columns))),
+		tileHeight: tileHeight,
+	}, nil
+}
+
+// MakeSprites renders a sprite sheet of evenly spaced frames and a WebVTT
+// track that maps time ranges to tiles. spriteName is the name the VTT
+// cues reference, it should be the base name of the sprite's S3 key so
+// players resolve it relative to the track
+func MakeSprites(input string, duration float64, spriteName string, o *SpriteOpts, j *JobQueue, userID string) (spritePath, vttPath string, err error) {
+	if duration <= 0 {
+		return "", "", fmt.Errorf("invalid duration %f", duration)
+	}
+
+	w, h, err := GetVideoSize(input)
+	if err != nil {
+		return "", "", err
+	}
+
+	l, err := makeSpriteLayout(duration, w, h, o)
+	if err != nil {
+		return "", "", err
+	}
+
+	spritePath = path.Join(os.TempDir(), util.RandStr(10)+".webp")
+
+	done := make(chan error, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	err = j.Enqueue(&FFmpegJob{
+		ID:     util.RandStr(5),
+		UserID: userID,
+		Args: &[]string{
+			"-y",
+			"-loglevel", "error",
+			"-i", input,
+			"-vf", fmt.Sprintf("fps=1/%f,scale=%d:%d,tile=%dx%d", l.interval, o.TileWidth, l.tileHeight, l.columns, l.rows),
+			"-frames:v", "1",
+			"-q:v", "75",
+			spritePath,
+		},
+		Ctx:        ctx,
+		Done:       done,
+		Background: true,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			os.Remove(spritePath)
+			return "", "", err
+		}
+	case <-ctx.Done():
+		os.Remove(spritePath)
+		return "", "", ctx.Err()
+	}
+
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+
+	for i := range l.tiles {
+		start := float64(i) * l.interval
+		end := min(start+l.interval, duration)
+		x := (i % l.columns) * o.TileWidth
+		y := (i / l.columns) * l.tileHeight
+
+		fmt.Fprintf(&vtt, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			util.FloatToTimestamp(start), util.FloatToTimestamp(end),
+			spriteName, x, y, o.TileWidth, l.tileHeight)
+	}
+
+	vttPath = path.Join(os.TempDir(), util.RandStr(10)+".vtt")
+	if err := os.WriteFile(vttPath, []byte(vtt.String()), 0o600); err != nil {
+		os.Remove(spritePath)
+		return "", "", fmt.Errorf("failed to write vtt file, %w", err)
+	}
+
+	zap.L().Debug("Created sprite sheet", zap.Int("tiles", l.tiles), zap.Float64("interval", l.interval))
+	return spritePath, vttPath, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import "testing"
+
+func TestMakeSpriteLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		w, h     int
+		opts     SpriteOpts
+	}{
+		{"short landscape", 30, 1920, 1080, SpriteOpts{Interval: 5, TileWidth: 160, Columns: 10}},
+		{"long landscape", 3 * 3600, 1920, 1080, SpriteOpts{Interval: 5, TileWidth: 160, Columns: 10}},
+		{"one column", 3600, 1920, 1080, SpriteOpts{Interval: 5, TileWidth: 640, Columns: 1}},
+		{"one column portrait", 3600, 1080, 1920, SpriteOpts{Interval: 1, TileWidth: 640, Columns: 1}},
+		{"wide grid", 3600, 1080, 1920, SpriteOpts{Interval: 1, TileWidth: 640, Columns: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := makeSpriteLayout(tt.duration, tt.w, tt.h, &tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if width := l.columns * tt.opts.TileWidth; width > maxWebPDimension {
+				t.Errorf("sheet is %dpx wide", width)
+			}
+
+			if height := l.rows * l.tileHeight; height > maxWebPDimension {
+				t.Errorf("sheet is %dpx high", height)
+			}
+
+			if l.tiles > l.columns*l.rows || l.tiles > maxSpriteTiles {
+				t.Errorf("%d tiles don't fit in %dx%d", l.tiles, l.columns, l.rows)
+			}
+
+			if covered := float64(l.tiles) * l.interval; covered < tt.duration-0.001 {
+				t.Errorf("tiles cover %.2fs of %.2fs", covered, tt.duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrSubtitleNoCues  = errors.New("subtitle file has no cues")
+	ErrSubtitleInvalid = errors.New("malformed subtitle file")
+)
+
+var (
+	cueTagRe    = regexp.MustCompile(`<[^>]*>`)
+	srtTimingRe = regexp.MustCompile(`^(\d{1,2}:\d{2}:\d{2})[,.](\d{3})\s*-->\s*(\d{1,2}:\d{2}:\d{2})[,.](\d{3})`)
+	vttTimingRe = regexp.MustCompile(`^((\d{1,2}:)?\d{2}:\d{2}\.\d{3})\s+-->\s+((\d{1,2}:)?\d{2}:\d{2}\.\d{3})`)
+)
+
+// ToWebVTT validates a subtitle track and converts it to WebVTT
+func ToWebVTT(data []byte, format string) ([]byte, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	switch format {
+	case "srt":
+		return srtToVTT(text)
+	case "vtt":
+		return checkVTT(text)
+	}
+
+	return nil, fmt.Errorf("unsupported subtitle format %s", format)
+}
+
+func srtToVTT(text string) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("WEBVTT\n\n")
+
+	cues := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, "-->") {
+			m := srtTimingRe.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				return nil, ErrSubtitleInvalid
+			}
+
+			fmt.Fprintf(&out, "%s.%s --> %s.%s\n", m[1], m[2], m[3], m[4])
+			cues++
+			continue
+		}
+
+		out.WriteString(line + "\n")
+	}
+
+	if cues == 0 {
+		return nil, ErrSubtitleNoCues
+	}
+
+	return out.Bytes(), nil
+}
+
+func checkVTT(text string) ([]byte, error) {
+	if !strings.HasPrefix(text, "WEBVTT") {
+		return nil, ErrSubtitleInvalid
+	}
+
+	cues := 0
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.Contains(line, "-->") {
+			continue
+		}
+
+		if !vttTimingRe.MatchString(strings.TrimSpace(line)) {
+			return nil, ErrSubtitleInvalid
+		}
+		cues++
+	}
+
+	if cues == 0 {
+		return nil, ErrSubtitleNoCues
+	}
+
+	return []byte(text), nil
+}
+
+// SubtitleText returns the text of every cue in a WebVTT track without
+// timings, identifiers or styling tags
+func SubtitleText(vtt []byte) string {
+	var out strings.Builder
+
+	inCue := false
+	for _, line := range strings.Split(string(vtt), "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			inCue = false
+			continue
+		}
+
+		if strings.Contains(line, "-->") {
+			inCue = true
+			continue
+		}
+
+		if !inCue {
+			continue
+		}
+
+		if out.Len() > 0 {
+			out.WriteByte(' ')
+		}
+		out.WriteString(cueTagRe.ReplaceAllString(line, ""))
+	}
+
+	return out.String()
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTooManyTags = errors.New("files can have at most 32 tags")
+
+// EnsureTags returns the user's tags with the provided names, creating the
+// ones that don't exist yet. Names have to be normalized already
+func EnsureTags(tx *gorm.DB, userID string, names []string) ([]model.Tag, error) {
+	now := time.Now().Unix()
+
+	rows := make([]model.Tag, len(names))
+	for i, name := range names {
+		rows[i] = model.Tag{UserID: userID, Name: name, CreatedAt: now}
+	}
+
+	err := tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []model.Tag
+	err = tx.
+		Where("user_id = ? AND name IN ?", userID, names).
+		Find(&tags).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// AddFileTags puts tags on a file. Returns ErrTooManyTags without changing
+// anything if the file would end up with too many tags
+func AddFileTags(tx *gorm.DB, fileID uint, tags []model.Tag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(tags))
+	for i, t := range tags {
+		ids[i] = t.ID
+	}
+
+	var existing, overlap int64
+
+	err := tx.
+		Model(model.FileTag{}).
+		Where("file_id = ?", fileID).
+		Count(&existing).
+		Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.
+		Model(model.FileTag{}).
+		Where("file_id = ? AND tag_id IN ?", fileID, ids).
+		Count(&overlap).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if existing+int64(len(ids))-overlap > validators.MaxFileTags {
+		return ErrTooManyTags
+	}
+
+	rows := make([]model.FileTag, len(ids))
+	for i, id := range ids {
+		rows[i] = model.FileTag{FileID: fileID, TagID: id}
+	}
+
+	return tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&rows).
+		Error
+}
+
+// RemoveFileTags takes tags off files by name
+func RemoveFileTags(tx *gorm.DB, userID string, fileIDs []uint, names []string) error {
+	return tx.
+		Where("file_id IN ? AND tag_id IN (?)", fileIDs,
+			tx.Model(model.Tag{}).Select("id").Where("user_id = ? AND name IN ?", userID, names)).
+		Delete(model.FileTag{}).
+		Error
+}
+
+// LoadTags fills in the tags of files
+func LoadTags(db *gorm.DB, files []model.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+
+	var rows []struct {
+		FileID uint
+		Name   string
+	}
+
+	err := db.
+		Model(model.FileTag{}).
+		Select("file_tags.file_id, tags.name").
+		Joins("JOIN tags ON tags.id = file_tags.tag_id").
+		Where("file_tags.file_id IN ?", ids).
+		Order("tags.name asc").
+		Scan(&rows).
+		Error
+	if err != nil {
+		return err
+	}
+
+	byFile := map[uint][]string{}
+	for _, r := range rows {
+		byFile[r.FileID] = append(byFile[r.FileID], r.Name)
+	}
+
+	for i := range files {
+		files[i].Tags = byFile[files[i].ID]
+		if files[i].Tags == nil {
+			files[i].Tags = []string{}
+		}
+	}
+
+	return nil
+}
+
+// LoadFileTags fills in the tags of a single file
+func LoadFileTags(db *gorm.DB, f *model.File) error {
+	files := []model.File{*f}
+	if err := LoadTags(db, files); err != nil {
+		return err
+	}
+
+	f.Tags = files[0].Tags
+	return nil
+}
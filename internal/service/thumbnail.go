@@ -7,16 +7,76 @@ import (
 	"context"
 	"os"
 	"path"
+	"strconv"
 	"time"
 
 	"go.uber.org/zap"
 )
 
-// MakeThumbnail creates a thumbnail from a multipart.File
-// TODO :Cleanup
+const (
+	// Amount of keyframes the thumbnail filter picks the best one from
+	thumbCandidates = 50
+	thumbScale      = "scale=w=640:h=360:force_original_aspect_ratio=decrease"
+)
+
+// MakeThumbnail creates a thumbnail for a video. Only keyframes are decoded
+// and ffmpeg's thumbnail filter picks the most representative one out of
+// them, which avoids the black frames videos usually start with
 func MakeThumbnail(input string, j *JobQueue, userID string) (p string, err error) {
 	zap.L().Debug("Creating thumbnail for video")
 
+	return runThumbnailJob(j, userID, func(out string) []string {
+		return []string{
+			"-loglevel", "error",
+			"-skip_frame", "nokey",
+			"-i", input,
+			"-vf", "thumbnail=" + strconv.Itoa(thumbCandidates) + "," + thumbScale,
+			"-frames:v", "1",
+			"-fps_mode", "vfr",
+			"-q:v", "75",
+			out,
+		}
+	})
+}
+
+// MakeThumbnailAt creates a thumbnail from the frame at ts seconds. The
+// input can be a local path or an URL
+func MakeThumbnailAt(input string, ts float64, j *JobQueue, userID string) (string, error) {
+	zap.L().Debug("Creating thumbnail at timestamp", zap.Float64("ts", ts))
+
+	return runThumbnailJob(j, userID, func(out string) []string {
+		return []string{
+			"-loglevel", "error",
+			"-ss", util.FloatToTimestamp(ts),
+			"-i", input,
+			"-vf", thumbScale,
+			"-frames:v", "1",
+			"-q:v", "75",
+			out,
+		}
+	})
+}
+
+// ConvertThumbnail turns an uploaded image into a thumbnail with
+// the same format and size as generated ones
+func ConvertThumbnail(input string, j *JobQueue, userID string) (string, error) {
+	zap.L().Debug("Converting uploaded image to thumbnail")
+
+	return runThumbnailJob(j, userID, func(out string) []string {
+		return []string{
+			"-loglevel", "error",
+			"-i", input,
+			"-vf", thumbScale,
+			"-frames:v", "1",
+			"-q:v", "75",
+			out,
+		}
+	})
+}
+
+// runThumbnailJob enqueues a job that writes a webp image to a temporary
+// path and returns the path once the job is done
+func runThumbnailJob(j *JobQueue, userID string, makeArgs func(out string) []string) (string, error) {
 	done := make(chan error, 1)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*1)
 	defer cancel()
@@ -24,10 +84,12 @@ func MakeThumbnail(input string, j *JobQueue, userID string) (p string, err erro
 	thumbPath := path.Join(os.TempDir(), util.RandStr(10)+".webp")
 	zap.L().Debug("Writing thumbnail file", zap.String("path", thumbPath))
 
-	err = j.Enqueue(&FFmpegJob{
+	args := append([]string{"-y"}, makeArgs(thumbPath)...)
+
+	err := j.Enqueue(&FFmpegJob{
 		ID:     util.RandStr(5),
 		UserID: userID,
-		Args:   &[]string{"-loglevel", "error", "-ss", "0", "-i", input, "-frames:v", "1", "-q:v", "2", "-vf", "scale=-640:360", thumbPath},
+		Args:   &args,
 		Done:   done,
 		Ctx:    ctx,
 	})
@@ -38,10 +100,12 @@ func MakeThumbnail(input string, j *JobQueue, userID string) (p string, err erro
 	select {
 	case err := <-done:
 		if err != nil {
+			os.Remove(thumbPath)
 			return "", err
 		}
-		// case <-ctx.Done():
-		// 	return "", nil
+	case <-ctx.Done():
+		os.Remove(thumbPath)
+		return "", ctx.Err()
 	}
 
 	return thumbPath, nil
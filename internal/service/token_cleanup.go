@@ -34,7 +34,7 @@ func TokenCleanup(t time.Duration, db *gorm.DB) {
 				zap.L().Debug("Cleaning up expired tokens")
 
 				err = db.
-					Where("id LIKE ?", toCleanIds).
+					Where("id IN ?", toCleanIds).
 					Delete(model.VerificationToken{}).
 					Error
 				if err != nil {
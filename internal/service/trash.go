@@ -0,0 +1,69 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const defaultTrashRetention = 30 // In days
+
+// TrashFiles moves files to the trash. They keep counting against the
+// storage of their owner until they're purged
+func TrashFiles(tx *gorm.DB, ids []uint) error {
+	return tx.
+		Model(model.File{}).
+		Where("id IN ?", ids).
+		Update("deleted_at", time.Now().Unix()).
+		Error
+}
+
+// RestoreFiles takes files of a user out of the trash and returns how many
+// were restored
+func RestoreFiles(tx *gorm.DB, userID string, ids []uint) (int64, error) {
+	res := tx.
+		Unscoped().
+		Model(model.File{}).
+		Where("user_id = ? AND id IN ? AND deleted_at IS NOT NULL", userID, ids).
+		Update("deleted_at", nil)
+
+	return res.RowsAffected, res.Error
+}
+
+// TrashRetention returns how long files stay in the trash before they're
+// purged, set with TRASH_RETENTION_DAYS
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultTrashRetention
+	}
+
+	return time.Hour * 24 * time.Duration(days)
+}
+
+// TrashPurge periodically purges files that were in the trash for longer
+// than the retention period
+func TrashPurge(t time.Duration, db *gorm.DB) {
+	ticker := time.NewTicker(t)
+
+	zap.L().Debug("Trash purge attached", zap.Duration("tick_every", t))
+
+	go func() {
+		for range ticker.C {
+			cutoff := time.Now().Add(-TrashRetention()).Unix()
+
+			purged, err := PurgeFiles(db, "deleted_at IS NOT NULL AND deleted_at <= ?", cutoff)
+			if err != nil {
+				zap.L().Error("Failed to purge trash", zap.Error(err))
+			}
+
+			if purged > 0 {
+				zap.L().Debug("Trash purge finished", zap.Int("purged", purged))
+			}
+		}
+	}()
+}
@@ -4,8 +4,11 @@ import (
 	a "bitwise74/video-api/aws"
 	"bitwise74/video-api/internal/model"
 	"bitwise74/video-api/pkg/util"
+	"bytes"
+	"cmp"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 	"time"
@@ -13,7 +16,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 const minMultipartSize = 12 << 20
@@ -21,17 +26,63 @@ const minMultipartSize = 12 << 20
 type Uploader struct {
 	S3       *a.S3Client
 	JobQueue *JobQueue
+	DB       *gorm.DB // Used to look up blobs so stored content isn't uploaded again
 }
 
-func NewUploader(j *JobQueue, s *a.S3Client) *Uploader {
+func NewUploader(j *JobQueue, s *a.S3Client, db *gorm.DB) *Uploader {
 	return &Uploader{
 		JobQueue: j,
 		S3:       s,
+		DB:       db,
 	}
 }
 
-// Do should be used with a file that's ready for upload and was checked. It creates a thumbnail for the video file and uploads both files. Providing an override value will instead update an existing file. Files are deleted after upload
-func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File, error) {
+// Extensions used for the keys of each supported format. Animated WebP can't
+// use .webp because that's taken by the thumbnail
+var formatExts = map[string]string{
+	"video/mp4":  ".mp4",
+	"image/gif":  ".gif",
+	"image/webp": ".anim.webp",
+}
+
+// Do should be used with a file that's ready for upload and was checked. It creates a thumbnail for the video file and uploads both files. The video is stored under its content hash and isn't uploaded again if a blob with the same content exists. Files are deleted after upload
+func (u *Uploader) Do(p, name, userID string) (*model.File, error) {
+	return u.DoAs(p, name, userID, "video/mp4")
+}
+
+// DoAs works like Do but stores the file as the provided format. The blob of
+// the returned file is held, see HoldBlob. The caller has to acquire it with
+// AcquireBlob and drop the hold with ReleaseHold in the transaction that saves
+// the file, or call Abandon if it isn't saved
+func (u *Uploader) DoAs(p, name, userID, format string) (*model.File, error) {
+	return u.DoPrepared(p, name, userID, format, &Prepared{})
+}
+
+// Prepared holds what a caller made for a file already. Fields that are
+// left empty are made from the file itself
+type Prepared struct {
+	ThumbPath string // Deleted after upload like the file
+	Duration  float64
+
+	// Hash of the bytes the user uploaded before they were processed. It's
+	// stored as the file's SHA256 to find duplicates, the video is still
+	// stored under the hash of its own content
+	SHA256 string
+}
+
+// DoPrepared works like DoAs but uses what was prepared instead of making it
+// from the file. Animations can't always be decoded by ffmpeg so their
+// thumbnail and duration come from the source video
+func (u *Uploader) DoPrepared(p, name, userID, format string, prep *Prepared) (*model.File, error) {
+	if prep.ThumbPath != "" {
+		defer os.Remove(prep.ThumbPath)
+	}
+
+	ext, ok := formatExts[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+
 	videoFile, err := os.Open(p)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open video file, %w", err)
@@ -41,9 +92,19 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 	videoStat, _ := videoFile.Stat()
 
-	thumbPath, err := MakeThumbnail(p, u.JobQueue, userID)
+	sum, err := HashFile(p)
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload to S3, %w", err)
+		return nil, err
+	}
+
+	videoKey := blobKey(sum, ext)
+
+	thumbPath := prep.ThumbPath
+	if thumbPath == "" {
+		thumbPath, err = MakeThumbnail(p, u.JobQueue, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload to S3, %w", err)
+		}
 	}
 
 	thumbFile, err := os.Open(thumbPath)
@@ -53,22 +114,25 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 	defer os.Remove(thumbPath)
 	defer thumbFile.Close()
 
+	// Taken before anything is uploaded so the object can't be deleted
+	// between the check below and the save of the file
+	refs, err := HoldBlob(u.DB, videoKey, sum, videoStat.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to hold blob, %w", err)
+	}
+
 	// Prepare things for background operations
 	var wg sync.WaitGroup
 	wg.Add(3)
 
-	key := util.RandStr(10)
+	// Thumbnails can be replaced so they're never shared
+	thumbKey := util.RandStr(10) + ".webp"
 
 	errors := make(chan error, 3)
-	uploadedKeys := []string{}
 
 	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Minute))
 	defer cancel()
 
-	if len(override) > 0 {
-		key = override[0]
-	}
-
 	// Thumbnail upload
 	go func() {
 		defer wg.Done()
@@ -76,7 +140,7 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 		_, err := u.S3.C.PutObject(ctx, &s3.PutObjectInput{
 			Bucket:       u.S3.Bucket,
-			Key:          aws.String(key + ".webp"),
+			Key:          aws.String(thumbKey),
 			Body:         thumbFile,
 			CacheControl: aws.String("public, max-age=31536000, immutable"),
 			ContentType:  aws.String("image/webp"),
@@ -86,7 +150,6 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 			return
 		}
 
-		uploadedKeys = append(uploadedKeys, key+".webp")
 		errors <- nil
 	}()
 
@@ -95,6 +158,16 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 		defer wg.Done()
 		zap.L().Debug("Starting upload_video subprocess")
 
+		// Other holders could still be uploading the same content so the
+		// object has to exist too
+		if refs > 1 {
+			if _, err := u.ObjectSize(ctx, videoKey); err == nil {
+				zap.L().Debug("Blob exists already, skipping video upload", zap.String("key", videoKey))
+				errors <- nil
+				return
+			}
+		}
+
 		var uploader *manager.Uploader
 		if videoStat.Size() > minMultipartSize {
 			uploader = manager.NewUploader(u.S3.C, func(u *manager.Uploader) {
@@ -105,10 +178,10 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 		objectInput := &s3.PutObjectInput{
 			Bucket:        u.S3.Bucket,
-			Key:           aws.String(key + ".mp4"),
+			Key:           aws.String(videoKey),
 			Body:          videoFile,
 			ContentLength: aws.Int64(videoStat.Size()),
-			ContentType:   aws.String("video/mp4"),
+			ContentType:   aws.String(format),
 			CacheControl:  aws.String("public, max-age=31536000, immutable"),
 		}
 
@@ -123,14 +196,19 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 			return
 		}
 
-		uploadedKeys = append(uploadedKeys, key+".mp4")
 		errors <- nil
 	}()
 
-	var duration float64
+	duration := prep.Duration
 
 	go func() {
 		defer wg.Done()
+
+		if duration > 0 {
+			errors <- nil
+			return
+		}
+
 		zap.L().Debug("Starting ffprobe_duration subprocess")
 		var err error
 
@@ -147,16 +225,15 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 		if err := <-errors; err != nil {
 			cancel()
 
-			for _, id := range uploadedKeys {
-				_, err := u.S3.C.DeleteObject(context.Background(), &s3.DeleteObjectInput{
-					Bucket: u.S3.Bucket,
-					Key:    aws.String(id),
-				})
-				if err != nil {
-					zap.L().Error("Failed to cleanup after faile uploads", zap.String("id", id), zap.Error(err))
-				} else {
-					zap.L().Debug("Cleaned up after failed upload", zap.String("id", id))
-				}
+			// Uploads that are still running could finish after the cancel
+			// so every goroutine has to be done before cleaning up
+			wg.Wait()
+
+			abandoned := &model.File{FileKey: videoKey, ThumbKey: thumbKey}
+			if err := u.Abandon(abandoned); err != nil {
+				zap.L().Error("Failed to cleanup after failed uploads", zap.Strings("keys", abandoned.ObjectKeys()), zap.Error(err))
+			} else {
+				zap.L().Debug("Cleaned up after failed upload", zap.Strings("keys", abandoned.ObjectKeys()))
 			}
 
 			return nil, err
@@ -167,11 +244,12 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 	fileEnt := &model.File{
 		UserID:       userID,
-		FileKey:      key + ".mp4",
-		ThumbKey:     key + ".webp",
+		FileKey:      videoKey,
+		ThumbKey:     thumbKey,
 		OriginalName: name,
-		Format:       "video/mp4",
+		Format:       format,
 		Size:         videoStat.Size(),
+		SHA256:       cmp.Or(prep.SHA256, sum),
 		Tags:         []string{},
 		State:        "ready",
 		Version:      1,
@@ -181,3 +259,139 @@ func (u *Uploader) Do(p, name, userID string, override ...string) (*model.File,
 
 	return fileEnt, nil
 }
+
+// PutFile uploads a local file to the provided key, replacing the object if
+// it exists already. Clients should bust caches by bumping File.Version
+func (u *Uploader) PutFile(ctx context.Context, p, key, contentType string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("failed to open file, %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file, %w", err)
+	}
+
+	_, err = u.S3.C.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        u.S3.Bucket,
+		Key:           aws.String(key),
+		Body:          f,
+		ContentLength: aws.Int64(stat.Size()),
+		ContentType:   aws.String(contentType),
+		CacheControl:  aws.String("public, max-age=31536000, immutable"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to s3, %w", key, err)
+	}
+
+	return nil
+}
+
+// PutBytes uploads data to the provided key, replacing the object if it
+// exists already
+func (u *Uploader) PutBytes(ctx context.Context, data []byte, key, contentType string) error {
+	_, err := u.S3.C.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        u.S3.Bucket,
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType),
+		CacheControl:  aws.String("public, max-age=31536000, immutable"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to s3, %w", key, err)
+	}
+
+	return nil
+}
+
+// GetFile downloads an object into a local file at p
+func (u *Uploader) GetFile(ctx context.Context, key, p string) error {
+	resp, err := u.S3.C.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: u.S3.Bucket,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download %s from s3, %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	f, err := os.Create(p)
+	if err != nil {
+		return fmt.Errorf("failed to create file, %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("failed to write %s, %w", key, err)
+	}
+
+	return nil
+}
+
+// ObjectSize returns the size of a stored object
+func (u *Uploader) ObjectSize(ctx context.Context, key string) (int64, error) {
+	resp, err := u.S3.C.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: u.S3.Bucket,
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up %s in s3, %w", key, err)
+	}
+
+	return aws.ToInt64(resp.ContentLength), nil
+}
+
+// DeleteKeys deletes objects in batches of 1000 which is the most S3 accepts
+// in a single request
+func (u *Uploader) DeleteKeys(ctx context.Context, keys []string) error {
+	failed, err := u.deleteObjects(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	for key, msg := range failed {
+		zap.L().Error("Failed to delete object", zap.String("key", key), zap.String("message", msg))
+	}
+
+	return nil
+}
+
+// deleteObjects works like DeleteKeys but returns the error message of
+// every key S3 couldn't delete. Keys that weren't sent because a request
+// failed are included
+func (u *Uploader) deleteObjects(ctx context.Context, keys []string) (map[string]string, error) {
+	failed := map[string]string{}
+
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+
+		objects := make([]types.ObjectIdentifier, end-start)
+		for i, key := range keys[start:end] {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		resp, err := u.S3.C.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: u.S3.Bucket,
+			Delete: &types.Delete{
+				Objects: objects,
+			},
+		})
+		if err != nil {
+			// Nothing is known about the keys of this batch and the ones after it
+			for _, key := range keys[start:] {
+				failed[key] = err.Error()
+			}
+
+			return failed, fmt.Errorf("failed to delete objects from s3, %w", err)
+		}
+
+		for _, e := range resp.Errors {
+			failed[aws.ToString(e.Key)] = aws.ToString(e.Message)
+		}
+	}
+
+	return failed, nil
+}
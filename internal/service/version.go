@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/validators"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SnapshotOriginal stores the current objects of a file as its first version.
+// Files get their first version lazily, right before they are edited for
+// the first time, so it's a no-op if the file has versions already
+func SnapshotOriginal(tx *gorm.DB, file *model.File) error {
+	var count int64
+
+	err := tx.
+		Model(model.FileVersion{}).
+		Where("file_id = ?", file.ID).
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	err = tx.Create(&model.FileVersion{
+		FileID:    file.ID,
+		UserID:    file.UserID,
+		Number:    1,
+		FileKey:   file.FileKey,
+		ThumbKey:  file.ThumbKey,
+		Size:      file.Size,
+		SHA256:    file.SHA256,
+		Duration:  file.Duration,
+		CreatedAt: file.CreatedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return AcquireBlob(tx, file.FileKey, file.SHA256, file.Size)
+}
+
+// AddVersion stores the current objects of a file as a new version made
+// with the provided options
+func AddVersion(tx *gorm.DB, file *model.File, opts *validators.ProcessingOptions) (*model.FileVersion, error) {
+	var last int
+
+	err := tx.
+		Model(model.FileVersion{}).
+		Where("file_id = ?", file.ID).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&last).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode processing options, %w", err)
+	}
+
+	v := &model.FileVersion{
+		FileID:    file.ID,
+		UserID:    file.UserID,
+		Number:    last + 1,
+		FileKey:   file.FileKey,
+		ThumbKey:  file.ThumbKey,
+		Size:      file.Size,
+		SHA256:    file.SHA256,
+		Duration:  file.Duration,
+		Options:   options,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if err := tx.Create(v).Error; err != nil {
+		return nil, err
+	}
+
+	if err := AcquireBlob(tx, v.FileKey, v.SHA256, v.Size); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// RetainedSize returns the amount of bytes every stored version of a file
+// takes up. Files that were never edited only have their current object
+func RetainedSize(db *gorm.DB, file *model.File) (int64, error) {
+	var size int64
+	var count int64
+
+	err := db.
+		Model(model.FileVersion{}).
+		Where("file_id = ?", file.ID).
+		Count(&count).
+		Error
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return file.Size, nil
+	}
+
+	err = db.
+		Model(model.FileVersion{}).
+		Where("file_id = ?", file.ID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&size).
+		Error
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// derivedKeys returns the keys of objects that are generated from the
+// current version and have to be made again once it changes
+func derivedKeys(file *model.File) []string {
+	keys := []string{}
+
+	for _, k := range []string{file.SpriteKey, file.SpriteVTTKey, file.PreviewKey} {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// SwitchVersion points a file to the objects of a version and moves the
+// file's blob reference along. Objects derived from the previous version
+// and blobs nothing references anymore are returned so they can be deleted
+// once the change is committed
+func SwitchVersion(tx *gorm.DB, file *model.File, v *model.FileVersion) ([]string, error) {
+	stale := derivedKeys(file)
+
+	if err := AcquireBlob(tx, v.FileKey, v.SHA256, v.Size); err != nil {
+		return nil, err
+	}
+
+	// Objects that aren't content addressed are still owned by a version
+	if isBlobKey(file.FileKey) {
+		unused, err := ReleaseBlobs(tx, []string{file.FileKey})
+		if err != nil {
+			return nil, err
+		}
+
+		stale = append(stale, unused...)
+	}
+
+	file.FileKey = v.FileKey
+	file.ThumbKey = v.ThumbKey
+	file.Size = v.Size
+	file.SHA256 = v.SHA256
+	file.Duration = v.Duration
+	file.Fingerprint = ""
+	file.SpriteKey = ""
+	file.SpriteVTTKey = ""
+	file.PreviewKey = ""
+	file.Version++
+
+	return stale, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bitwise74/video-api/internal/model"
+	"bitwise74/video-api/pkg/util"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ResolveWatermark loads a user's watermark preset and prepares the file
+// ffmpeg needs for it. Image watermarks are downloaded and text watermarks
+// are written to a file so the text doesn't have to be escaped. The caller
+// has to remove the returned path. Returns gorm.ErrRecordNotFound if the
+// user doesn't own the preset
+func ResolveWatermark(ctx context.Context, db *gorm.DB, u *Uploader, userID string, id uint) (*model.Watermark, string, error) {
+	var wm model.Watermark
+
+	err := db.
+		Where("user_id = ? AND id = ?", userID, id).
+		First(&wm).
+		Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	if wm.Type == "text" {
+		p := path.Join(os.TempDir(), util.RandStr(10)+".txt")
+		if err := os.WriteFile(p, []byte(wm.Text), 0o600); err != nil {
+			return nil, "", fmt.Errorf("failed to write watermark text, %w", err)
+		}
+
+		return &wm, p, nil
+	}
+
+	p := path.Join(os.TempDir(), util.RandStr(10)+".png")
+	if err := u.GetFile(ctx, wm.ImageKey, p); err != nil {
+		os.Remove(p)
+		return nil, "", err
+	}
+
+	return &wm, p, nil
+}
+
+// watermarkPosition returns overlay coordinates. Text is measured with
+// tw/th by drawtext while overlay uses w/h for the overlaid image
+func watermarkPosition(wm *model.Watermark) (x, y string) {
+	width, height := "w", "h"
+	mainW, mainH := "W", "H"
+
+	if wm.Type == "text" {
+		width, height = "tw", "th"
+		mainW, mainH = "w", "h"
+	}
+
+	m := fmt.Sprint(wm.Margin)
+
+	switch wm.Position {
+	case "top-left":
+		return m, m
+	case "top-right":
+		return mainW + "-" + width + "-" + m, m
+	case "bottom-left":
+		return m, mainH + "-" + height + "-" + m
+	case "center":
+		return "(" + mainW + "-" + width + ")/2", "(" + mainH + "-" + height + ")/2"
+	}
+
+	return mainW + "-" + width + "-" + m, mainH + "-" + height + "-" + m
+}
+
+// drawTextFilter returns the filter used for text watermarks
+func drawTextFilter(wm *model.Watermark, textPath string) string {
+	x, y := watermarkPosition(wm)
+
+	opts := []string{
+		"textfile=" + escapeFilterPath(textPath),
+		fmt.Sprintf("fontcolor=white@%.2f", wm.Opacity),
+		fmt.Sprintf("bordercolor=black@%.2f", wm.Opacity),
+		"borderw=2",
+		fmt.Sprintf("fontsize=h*%.3f", wm.Scale),
+		"x=" + x,
+		"y=" + y,
+	}
+
+	if font := os.Getenv("WATERMARK_FONT_FILE"); font != "" {
+		opts = append(opts, "fontfile="+escapeFilterPath(font))
+	}
+
+	return "drawtext=" + strings.Join(opts, ":")
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"bitwise74/video-api/app"
 	"bitwise74/video-api/config"
+	"bitwise74/video-api/db"
+	"flag"
+	"fmt"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +13,9 @@ import (
 )
 
 func main() {
+	migrationsDryRun := flag.Bool("migrations-dry-run", false, "List pending migrations without running them and exit")
+	flag.Parse()
+
 	gin.SetMode(gin.ReleaseMode)
 
 	err := config.Setup()
@@ -17,6 +23,27 @@ func main() {
 		panic(err)
 	}
 
+	if *migrationsDryRun {
+		conn, err := db.Open()
+		if err != nil {
+			panic(err)
+		}
+
+		pending, err := db.PendingMigrations(conn)
+		if err != nil {
+			panic(err)
+		}
+
+		if len(pending) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+		for _, name := range pending {
+			fmt.Println(name)
+		}
+		return
+	}
+
 	router, err := app.NewRouter()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"bitwise74/video-api/internal/model"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// NewAdminMiddleware only lets through users whose email is listed in
+// SECURITY_ADMIN_EMAILS. It has to run after the JWT middleware
+func NewAdminMiddleware(d *gorm.DB) gin.HandlerFunc {
+	admins := strings.Split(os.Getenv("SECURITY_ADMIN_EMAILS"), ",")
+	for i := range admins {
+		admins[i] = strings.ToLower(strings.TrimSpace(admins[i]))
+	}
+
+	return func(c *gin.Context) {
+		requestID := c.MustGet("requestID").(string)
+		userID := c.MustGet("userID").(string)
+
+		var email string
+
+		err := d.
+			Model(model.User{}).
+			Where("id = ?", userID).
+			Select("email").
+			Scan(&email).
+			Error
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":     "Internal server error",
+				"requestID": requestID,
+			})
+
+			zap.L().Error("Failed to fetch user email", zap.Error(err), zap.String("requestID", requestID))
+			return
+		}
+
+		email = strings.ToLower(email)
+		if email == "" || !slices.Contains(admins, email) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":     "Admin access required",
+				"requestID": requestID,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
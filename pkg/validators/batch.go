@@ -0,0 +1,52 @@
+package validators
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const MaxBatchSize = 1000
+
+var validBatchOperations = []string{"delete", "private", "add_tags", "remove_tags", "move"}
+
+type BatchOptions struct {
+	IDs       []uint   `json:"ids"`
+	Operation string   `json:"operation"`
+	Private   *bool    `json:"private"`   // Used by the private operation
+	Tags      []string `json:"tags"`      // Used by the tag operations
+	FolderID  *uint    `json:"folder_id"` // Used by the move operation, 0 moves files to the root
+}
+
+// BatchValidator checks a batch request and normalizes the provided tags
+func BatchValidator(o *BatchOptions) (code int, err error) {
+	if len(o.IDs) == 0 {
+		return http.StatusBadRequest, errors.New("no file IDs provided")
+	}
+
+	if len(o.IDs) > MaxBatchSize {
+		return http.StatusBadRequest, errors.New("at most 1000 files can be changed at once")
+	}
+
+	switch o.Operation {
+	case "delete":
+	case "private":
+		if o.Private == nil {
+			return http.StatusBadRequest, errors.New("private has to be provided")
+		}
+	case "move":
+		if o.FolderID == nil {
+			return http.StatusBadRequest, errors.New("folder_id has to be provided")
+		}
+	case "add_tags", "remove_tags":
+		tags, err := TagsValidator(o.Tags)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		o.Tags = tags
+	default:
+		return http.StatusBadRequest, errors.New("operation must be one of " + strings.Join(validBatchOperations, ", "))
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,77 @@
+package validators
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMinExpiry = 60                 // 1 minute
+	defaultMaxExpiry = 60 * 60 * 24 * 365 // 1 year
+)
+
+// ExpiryValidator turns a TTL in seconds or an absolute unix timestamp into
+// the time a file expires at. Both being nil means the file never expires.
+// The result has to be between FILE_EXPIRY_MIN_TTL and FILE_EXPIRY_MAX_TTL
+// seconds from now
+func ExpiryValidator(ttl, at *int64) (*int64, error) {
+	if ttl != nil && at != nil {
+		return nil, errors.New("only one of expiry TTL and expiry time can be set")
+	}
+
+	now := time.Now().Unix()
+
+	var expiresAt int64
+	switch {
+	case ttl != nil:
+		expiresAt = now + *ttl
+	case at != nil:
+		expiresAt = *at
+	default:
+		return nil, nil
+	}
+
+	minTTL := expiryLimit("FILE_EXPIRY_MIN_TTL", defaultMinExpiry)
+	maxTTL := expiryLimit("FILE_EXPIRY_MAX_TTL", defaultMaxExpiry)
+
+	if expiresAt-now < minTTL || expiresAt-now > maxTTL {
+		return nil, errors.New("expiry must be between " + strconv.FormatInt(minTTL, 10) + " and " + strconv.FormatInt(maxTTL, 10) + " seconds from now")
+	}
+
+	return &expiresAt, nil
+}
+
+// FormExpiryValidator works like ExpiryValidator with the raw values of
+// multipart form fields. Empty values are treated as unset
+func FormExpiryValidator(ttl, at string) (*int64, error) {
+	var ttlVal, atVal *int64
+
+	if ttl != "" {
+		n, err := strconv.ParseInt(ttl, 10, 64)
+		if err != nil {
+			return nil, errors.New("expiry TTL must be a number")
+		}
+		ttlVal = &n
+	}
+
+	if at != "" {
+		n, err := strconv.ParseInt(at, 10, 64)
+		if err != nil {
+			return nil, errors.New("expiry time must be a unix timestamp")
+		}
+		atVal = &n
+	}
+
+	return ExpiryValidator(ttlVal, atVal)
+}
+
+func expiryLimit(env string, def int64) int64 {
+	n, err := strconv.ParseInt(os.Getenv(env), 10, 64)
+	if err != nil || n <= 0 {
+		return def
+	}
+
+	return n
+}
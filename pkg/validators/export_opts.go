@@ -0,0 +1,59 @@
+package validators
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	maxExportLength    = 30 // In seconds
+	defaultExportFPS   = 15
+	defaultExportWidth = 480
+)
+
+type ExportOptions struct {
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Width       int     `json:"width"`
+	FPS         int     `json:"fps"`
+	MaxSize     float64 `json:"max_size"` // In MB, 0 means no limit
+	SaveToCloud bool    `json:"save_to_cloud"`
+}
+
+// ExportOptsValidator checks the options of a GIF or WebP export against
+// the duration of the source video and fills in defaults
+func ExportOptsValidator(o *ExportOptions, duration float64) (code int, err error) {
+	if o.Start < 0 || o.End <= o.Start {
+		return http.StatusBadRequest, errors.New("end must be bigger than start")
+	}
+
+	if o.End > duration {
+		return http.StatusBadRequest, errors.New("end can't be past the end of the video")
+	}
+
+	if o.End-o.Start > maxExportLength {
+		return http.StatusBadRequest, errors.New("exports can be at most 30 seconds long")
+	}
+
+	if o.Width == 0 {
+		o.Width = defaultExportWidth
+	}
+
+	if o.Width < 16 || o.Width > 1280 {
+		return http.StatusBadRequest, errors.New("width must be between 16 and 1280")
+	}
+
+	if o.FPS == 0 {
+		o.FPS = defaultExportFPS
+	}
+
+	if o.FPS < 1 || o.FPS > 50 {
+		return http.StatusBadRequest, errors.New("fps must be between 1 and 50")
+	}
+
+	if o.MaxSize < 0 {
+		return http.StatusBadRequest, errors.New("max size can't be negative")
+	}
+
+	return 0, nil
+}
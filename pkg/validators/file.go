@@ -23,6 +23,7 @@ var (
 	ErrNoFile              = errors.New("no file provided")
 	ErrNoSpace             = errors.New("not enough space")
 	ErrEmptyFile           = errors.New("empty file")
+	ErrVideoTooLong        = errors.New("video is longer than your plan allows")
 )
 
 type partialUserData struct {
@@ -32,12 +33,18 @@ type partialUserData struct {
 
 const maxFileNameSize = 245 // Takes into account the thumbnail_ prefix
 
-func FileValidator(fh *multipart.FileHeader, db *gorm.DB, userID string) (int, multipart.File, error) {
+// FileValidator checks an uploaded file against the limits of the plan. The
+// UPLOAD_MAX_SIZE env var is used without a plan. The storage left is only
+// checked when a database is provided
+func FileValidator(fh *multipart.FileHeader, db *gorm.DB, userID string, plan *model.Plan) (int, multipart.File, error) {
 	if fh == nil {
 		return http.StatusBadRequest, nil, ErrNoFile
 	}
 
 	maxUploadSize, _ := strconv.ParseInt(os.Getenv("UPLOAD_MAX_SIZE"), 10, 64)
+	if plan != nil && plan.MaxUploadSize > 0 {
+		maxUploadSize = plan.MaxUploadSize
+	}
 
 	// No, this wasn't generated by gpt. Yes, I need these comments to not forget
 	// anything. Yes, I'm forgetful.
@@ -95,7 +102,12 @@ func FileValidator(fh *multipart.FileHeader, db *gorm.DB, userID string) (int, m
 			return http.StatusInternalServerError, nil, err
 		}
 
-		if data.UsedStorage+fh.Size > data.MaxStorage {
+		maxStorage := data.MaxStorage
+		if plan != nil {
+			maxStorage = plan.MaxStorage
+		}
+
+		if data.UsedStorage+fh.Size > maxStorage {
 			return http.StatusConflict, nil, ErrNoSpace
 		}
 	}
@@ -106,6 +118,15 @@ func FileValidator(fh *multipart.FileHeader, db *gorm.DB, userID string) (int, m
 	return 0, f, nil
 }
 
+// DurationValidator checks the length of a video against the plan
+func DurationValidator(duration float64, plan *model.Plan) (int, error) {
+	if plan != nil && plan.MaxDuration > 0 && duration > plan.MaxDuration {
+		return http.StatusRequestEntityTooLarge, ErrVideoTooLong
+	}
+
+	return 0, nil
+}
+
 func sanitizeFileName(n string) string {
 	n = filepath.Base(n)
 	n = strings.TrimSpace(n)
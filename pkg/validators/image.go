@@ -0,0 +1,55 @@
+package validators
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"slices"
+)
+
+const maxImageSize = 10 << 20
+
+var (
+	ErrImageTooLarge        = errors.New("image too large")
+	ErrImageTypeUnsupported = errors.New("unsupported image type, use png, jpeg or webp")
+)
+
+var allowedImageTypes = []string{"image/png", "image/jpeg", "image/webp"}
+
+// ImageValidator checks uploaded images. The type is sniffed from the
+// content because the header can't be trusted
+func ImageValidator(fh *multipart.FileHeader) (int, multipart.File, error) {
+	if fh == nil {
+		return http.StatusBadRequest, nil, ErrNoFile
+	}
+
+	if fh.Size == 0 {
+		return http.StatusBadRequest, nil, ErrEmptyFile
+	}
+
+	if fh.Size > maxImageSize {
+		return http.StatusRequestEntityTooLarge, nil, ErrImageTooLarge
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if !slices.Contains(allowedImageTypes, http.DetectContentType(head[:n])) {
+		f.Close()
+		return http.StatusBadRequest, nil, ErrImageTypeUnsupported
+	}
+
+	f.Seek(0, 0)
+
+	return 0, f, nil
+}
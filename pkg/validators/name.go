@@ -0,0 +1,19 @@
+package validators
+
+import (
+	"errors"
+	"strings"
+)
+
+const maxLibraryName = 64
+
+// LibraryName trims the name of a folder or collection and checks its length
+func LibraryName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" || len(name) > maxLibraryName {
+		return "", errors.New("name must be between 1 and 64 characters long")
+	}
+
+	return name, nil
+}
@@ -0,0 +1,30 @@
+package validators
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 250
+)
+
+// LimitValidator parses the limit query parameter of list endpoints. An
+// empty value uses def
+func LimitValidator(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New("Limit must be a number")
+	}
+
+	if limit <= 0 || limit > MaxPageLimit {
+		return 0, errors.New("Limit must be between 1 and 250")
+	}
+
+	return limit, nil
+}
@@ -0,0 +1,39 @@
+package validators
+
+import (
+	"bitwise74/video-api/internal/model"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const maxPlanName = 64
+
+// Formats a plan can allow. audio stands for audio-only processing outputs
+var PlanFormats = []string{"mp4", "audio", "gif", "webp"}
+
+// PlanValidator checks the limits of a plan and removes duplicate formats
+func PlanValidator(p *model.Plan) (code int, err error) {
+	p.Name = strings.TrimSpace(p.Name)
+
+	if p.Name == "" || len(p.Name) > maxPlanName {
+		return http.StatusBadRequest, errors.New("name must be between 1 and 64 characters long")
+	}
+
+	if p.MaxStorage < 0 || p.MaxUploadSize < 0 || p.MaxConcurrentJobs < 0 || p.MaxDuration < 0 {
+		return http.StatusBadRequest, errors.New("limits can't be negative")
+	}
+
+	for _, f := range p.OutputFormats {
+		if !slices.Contains(PlanFormats, f) {
+			return http.StatusBadRequest, fmt.Errorf("unknown output format %s, use one of %s", f, strings.Join(PlanFormats, ", "))
+		}
+	}
+
+	slices.Sort(p.OutputFormats)
+	p.OutputFormats = slices.Compact(p.OutputFormats)
+
+	return 0, nil
+}
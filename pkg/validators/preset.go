@@ -0,0 +1,38 @@
+package validators
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const maxPresetName = 64
+
+// PresetValidator checks the name and the options of a processing preset.
+// Options tied to a single file can't be saved
+func PresetValidator(name *string, o *ProcessingOptions) (code int, err error) {
+	if name != nil {
+		*name = strings.TrimSpace(*name)
+
+		if *name == "" || len(*name) > maxPresetName {
+			return http.StatusBadRequest, errors.New("name must be between 1 and 64 characters long")
+		}
+	}
+
+	if o == nil {
+		return 0, nil
+	}
+
+	if o.PresetID != 0 {
+		return http.StatusBadRequest, errors.New("presets can't reference other presets")
+	}
+
+	if o.SubtitleID != 0 || o.SubtitleMode != "" {
+		return http.StatusBadRequest, errors.New("subtitle tracks belong to a single file and can't be saved")
+	}
+
+	// The file size and the plan aren't known yet so the target size and the
+	// plan limits are checked when the preset is used
+	return ProcessingOptsValidator(o, math.Inf(1), nil)
+}
@@ -1,33 +1,142 @@
 package validators
 
 import (
+	"bitwise74/video-api/internal/model"
 	"errors"
+	"fmt"
 	"mime/multipart"
 	"net/http"
 )
 
+const (
+	DefaultAudioBitrate = 128 // In kbps
+	minAudioBitrate     = 32
+	maxAudioBitrate     = 320
+	maxVolumeGain       = 60 // In dB, applies both ways
+)
+
 type ProcessingOptions struct {
-	File           *multipart.FileHeader `form:"file"`
-	TrimStart      float64               `form:"trimStart"`
-	TrimEnd        float64               `form:"trimEnd"`
-	TargetSize     float64               `form:"targetSize"`
-	LosslessExport bool                  `form:"losslessExport"`
-	SaveToCloud    bool                  `form:"saveToCloud"`
+	File           *multipart.FileHeader `form:"file" json:"-"`
+	TrimStart      float64               `form:"trimStart" json:"trimStart"`
+	TrimEnd        float64               `form:"trimEnd" json:"trimEnd"`
+	TargetSize     float64               `form:"targetSize" json:"targetSize"`
+	LosslessExport bool                  `form:"losslessExport" json:"losslessExport"`
+	SaveToCloud    bool                  `form:"saveToCloud" json:"saveToCloud"`
+	RemoveAudio    bool                  `form:"removeAudio" json:"removeAudio"`
+	NormalizeAudio bool                  `form:"normalizeAudio" json:"normalizeAudio"` // EBU R128 loudness normalization
+	VolumeGain     float64               `form:"volumeGain" json:"volumeGain"`         // In dB
+	AudioTrack     int                   `form:"audioTrack" json:"audioTrack"`         // Index of the audio stream to keep, 0 is the first one
+	AudioBitrate   int                   `form:"audioBitrate" json:"audioBitrate"`     // In kbps, 0 uses DefaultAudioBitrate
+	AudioOnly      bool                  `form:"audioOnly" json:"audioOnly"`
+	SubtitleID     uint                  `form:"subtitleId" json:"subtitleId"`     // Subtitle track of a stored file
+	SubtitleMode   string                `form:"subtitleMode" json:"subtitleMode"` // burn or soft
+	WatermarkID    uint                  `form:"watermarkId" json:"watermarkId"`
+	PresetID       uint                  `form:"presetId" json:"presetId"` // Saved options, explicit fields override them
+
+	// Set by the handler once the subtitle track is downloaded
+	SubtitlePath     string `form:"-" json:"-"`
+	SubtitleLanguage string `form:"-" json:"-"`
+
+	// Set by the handler once the watermark is resolved. The path points to
+	// the image or to a file with the text of text watermarks
+	Watermark     *model.Watermark `form:"-" json:"-"`
+	WatermarkPath string           `form:"-" json:"-"`
 }
 
-// ProcessingOptsValidator needs the file header to check if the target size is bigger than the actual video size
-func ProcessingOptsValidator(o *ProcessingOptions, fSize float64) (code int, err error) {
-	if o.TrimStart > o.TrimEnd {
-		return http.StatusBadRequest, errors.New("trim start can't be bigger than trim end")
-	}
+// TouchesAudio reports if the audio stream can't be copied as is and
+// has to be encoded again
+func (o *ProcessingOptions) TouchesAudio() bool {
+	return o.NormalizeAudio ||
+		o.VolumeGain != 0 ||
+		o.AudioTrack > 0 ||
+		o.AudioBitrate > 0 ||
+		o.AudioOnly ||
+		o.TargetSize > 0
+}
+
+// ProcessingOptsValidator needs the file header to check if the target size is bigger than the actual video size.
+// The output format and the length of trimmed outputs are checked against the plan if one is provided
+func ProcessingOptsValidator(o *ProcessingOptions, fSize float64, plan *model.Plan) (code int, err error) {
+	if o.TrimEnd > 0 {
+		if o.TrimStart > o.TrimEnd {
+			return http.StatusBadRequest, errors.New("trim start can't be bigger than trim end")
+		}
 
-	if o.TrimStart == o.TrimEnd {
-		return http.StatusBadRequest, errors.New("trim start and trim end can't be the same")
+		if o.TrimStart == o.TrimEnd {
+			return http.StatusBadRequest, errors.New("trim start and trim end can't be the same")
+		}
 	}
 
 	if o.TargetSize != 0 && o.TargetSize == fSize || o.TargetSize > fSize {
 		return http.StatusBadRequest, errors.New("invalid target size provided")
 	}
 
+	if o.RemoveAudio && (o.NormalizeAudio || o.VolumeGain != 0 || o.AudioTrack > 0 || o.AudioBitrate > 0) {
+		return http.StatusBadRequest, errors.New("audio options can't be used when removing audio")
+	}
+
+	if o.RemoveAudio && o.AudioOnly {
+		return http.StatusBadRequest, errors.New("can't export audio only and remove audio at the same time")
+	}
+
+	if o.AudioOnly && o.SaveToCloud {
+		return http.StatusBadRequest, errors.New("audio-only exports can't be saved to the cloud")
+	}
+
+	if o.VolumeGain < -maxVolumeGain || o.VolumeGain > maxVolumeGain {
+		return http.StatusBadRequest, errors.New("volume gain must be between -60 and 60 dB")
+	}
+
+	if o.AudioTrack < 0 {
+		return http.StatusBadRequest, errors.New("audio track can't be negative")
+	}
+
+	if o.AudioBitrate != 0 && (o.AudioBitrate < minAudioBitrate || o.AudioBitrate > maxAudioBitrate) {
+		return http.StatusBadRequest, errors.New("audio bitrate must be between 32 and 320 kbps")
+	}
+
+	if o.SubtitleID != 0 && o.SubtitleMode != "burn" && o.SubtitleMode != "soft" {
+		return http.StatusBadRequest, errors.New("subtitle mode must be either burn or soft")
+	}
+
+	if o.SubtitleID == 0 && o.SubtitleMode != "" {
+		return http.StatusBadRequest, errors.New("no subtitle track selected")
+	}
+
+	if o.SubtitleID != 0 && o.AudioOnly {
+		return http.StatusBadRequest, errors.New("subtitles can't be added to audio-only exports")
+	}
+
+	if o.WatermarkID != 0 && o.AudioOnly {
+		return http.StatusBadRequest, errors.New("watermarks can't be added to audio-only exports")
+	}
+
+	if plan != nil {
+		format := "mp4"
+		if o.AudioOnly {
+			format = "audio"
+		}
+
+		if !plan.AllowsFormat(format) {
+			return http.StatusForbidden, fmt.Errorf("your plan doesn't allow %s outputs", format)
+		}
+
+		if o.TrimEnd > 0 {
+			if code, err := DurationValidator(o.TrimEnd-o.TrimStart, plan); err != nil {
+				return code, err
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// TrimValidator checks the trim range against the duration of the source
+// video. Unknown durations of zero are skipped
+func TrimValidator(o *ProcessingOptions, duration float64) (code int, err error) {
+	if duration > 0 && o.TrimStart >= duration {
+		return http.StatusBadRequest, errors.New("trim start must be before the end of the video")
+	}
+
 	return 0, nil
 }
@@ -0,0 +1,77 @@
+package validators
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxSubtitleSize  = 2 << 20
+	maxSubtitleLabel = 64
+)
+
+var (
+	ErrSubtitleTooLarge     = errors.New("subtitle file too large")
+	ErrSubtitleUnsupported  = errors.New("unsupported subtitle format, use srt or vtt")
+	ErrSubtitleEncoding     = errors.New("subtitle file must be UTF-8 encoded")
+	ErrSubtitleLanguage     = errors.New("invalid language tag provided")
+	ErrSubtitleLabelTooLong = errors.New("subtitle label is too long")
+)
+
+var languageRe = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// SubtitleValidator checks an uploaded subtitle track and returns its
+// content along with the format it's in
+func SubtitleValidator(fh *multipart.FileHeader, language, label string) (code int, data []byte, format string, err error) {
+	if fh == nil {
+		return http.StatusBadRequest, nil, "", ErrNoFile
+	}
+
+	format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fh.Filename)), ".")
+	if format != "srt" && format != "vtt" {
+		return http.StatusBadRequest, nil, "", ErrSubtitleUnsupported
+	}
+
+	if fh.Size == 0 {
+		return http.StatusBadRequest, nil, "", ErrEmptyFile
+	}
+
+	if fh.Size > maxSubtitleSize {
+		return http.StatusRequestEntityTooLarge, nil, "", ErrSubtitleTooLarge
+	}
+
+	if !languageRe.MatchString(language) {
+		return http.StatusBadRequest, nil, "", ErrSubtitleLanguage
+	}
+
+	if len(label) > maxSubtitleLabel {
+		return http.StatusBadRequest, nil, "", ErrSubtitleLabelTooLong
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+	defer f.Close()
+
+	data, err = io.ReadAll(io.LimitReader(f, maxSubtitleSize+1))
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", err
+	}
+
+	if len(data) > maxSubtitleSize {
+		return http.StatusRequestEntityTooLarge, nil, "", ErrSubtitleTooLarge
+	}
+
+	if !utf8.Valid(data) {
+		return http.StatusBadRequest, nil, "", ErrSubtitleEncoding
+	}
+
+	return 0, data, format, nil
+}
@@ -0,0 +1,59 @@
+package validators
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	MaxFileTags  = 32
+	maxTagLength = 32
+)
+
+var (
+	ErrTagLength  = errors.New("tags must be between 1 and 32 characters long")
+	ErrTagInvalid = errors.New("tags can't contain control characters")
+)
+
+// NormalizeTag trims and lowercases a tag so the same tag can't be
+// created twice with a different case
+func NormalizeTag(t string) (string, error) {
+	t = strings.ToLower(strings.TrimSpace(t))
+
+	if t == "" || len(t) > maxTagLength {
+		return "", ErrTagLength
+	}
+
+	if strings.IndexFunc(t, unicode.IsControl) != -1 {
+		return "", ErrTagInvalid
+	}
+
+	return t, nil
+}
+
+// TagsValidator normalizes a list of tags and removes duplicates
+func TagsValidator(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("no tags provided")
+	}
+
+	if len(tags) > MaxFileTags {
+		return nil, errors.New("at most 32 tags can be provided at once")
+	}
+
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t, err := NormalizeTag(t)
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+
+	return out, nil
+}
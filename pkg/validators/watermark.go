@@ -0,0 +1,92 @@
+package validators
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	maxWatermarkName   = 64
+	maxWatermarkText   = 200
+	maxWatermarkMargin = 500
+)
+
+var validWatermarkPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+
+// WatermarkOptions are the editable settings of a watermark preset. Pointers
+// are used so edits can tell apart missing fields from zero values
+type WatermarkOptions struct {
+	Name     *string  `form:"name" json:"name"`
+	Type     *string  `form:"type" json:"-"`
+	Text     *string  `form:"text" json:"text"`
+	Position *string  `form:"position" json:"position"`
+	Margin   *int     `form:"margin" json:"margin"`
+	Opacity  *float64 `form:"opacity" json:"opacity"`
+	Scale    *float64 `form:"scale" json:"scale"`
+}
+
+// WatermarkDefaults fills in every missing option of a new preset
+func WatermarkDefaults(o *WatermarkOptions) {
+	if o.Position == nil {
+		o.Position = ptr("bottom-right")
+	}
+
+	if o.Margin == nil {
+		o.Margin = ptr(16)
+	}
+
+	if o.Opacity == nil {
+		o.Opacity = ptr(0.8)
+	}
+
+	if o.Scale == nil {
+		if o.Type != nil && *o.Type == "text" {
+			o.Scale = ptr(0.05)
+		} else {
+			o.Scale = ptr(0.15)
+		}
+	}
+}
+
+// WatermarkValidator checks every provided option of a preset
+func WatermarkValidator(o *WatermarkOptions) (code int, err error) {
+	if o.Name != nil {
+		*o.Name = strings.TrimSpace(*o.Name)
+
+		if *o.Name == "" || len(*o.Name) > maxWatermarkName {
+			return http.StatusBadRequest, errors.New("name must be between 1 and 64 characters long")
+		}
+	}
+
+	if o.Type != nil && *o.Type != "image" && *o.Type != "text" {
+		return http.StatusBadRequest, errors.New("type must be either image or text")
+	}
+
+	if o.Text != nil && (*o.Text == "" || len(*o.Text) > maxWatermarkText) {
+		return http.StatusBadRequest, errors.New("text must be between 1 and 200 characters long")
+	}
+
+	if o.Position != nil && !slices.Contains(validWatermarkPositions, *o.Position) {
+		return http.StatusBadRequest, errors.New("invalid position provided")
+	}
+
+	if o.Margin != nil && (*o.Margin < 0 || *o.Margin > maxWatermarkMargin) {
+		return http.StatusBadRequest, errors.New("margin must be between 0 and 500")
+	}
+
+	if o.Opacity != nil && (*o.Opacity <= 0 || *o.Opacity > 1) {
+		return http.StatusBadRequest, errors.New("opacity must be bigger than 0 and at most 1")
+	}
+
+	if o.Scale != nil && (*o.Scale <= 0 || *o.Scale > 1) {
+		return http.StatusBadRequest, errors.New("scale must be bigger than 0 and at most 1")
+	}
+
+	return 0, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}